@@ -16,12 +16,17 @@
 
 package golanghelpers
 
-import "github.com/spf13/cobra"
+import (
+	"github.com/mrsimonemms/golang-helpers/logger"
+	"github.com/spf13/cobra"
+)
 
-// Hide the default value to avoid spaffing the API to command line
+// Hide the default value to avoid spaffing the API to command line. The value
+// is also registered as a secret so it's masked in the logs.
 func HideCommandOutput(cmd *cobra.Command, key string) {
 	v := cmd.Flags().Lookup(key)
 	if s := v.Value; s.String() != "" {
-		v.DefValue = "***"
+		v.DefValue = logger.Redacted
+		logger.AddSecret(s.String())
 	}
 }
@@ -19,13 +19,18 @@ package golanghelpers
 import (
 	"errors"
 
+	"github.com/mrsimonemms/golang-helpers/logger"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
 type FatalError struct {
-	Cause      error
-	Msg        string
+	Cause error
+	Msg   string
+	// Attrs are key/value pairs added to the message on the shared logger
+	Attrs []any
+	// Logger and WithParams write directly to zerolog instead of the shared
+	// logger. If either is set, Attrs is ignored.
 	Logger     func() *zerolog.Event
 	WithParams func(l *zerolog.Event) *zerolog.Event
 }
@@ -49,6 +54,15 @@ func HandleFatalError(err error) int {
 			f.Msg = defaultMsg
 		}
 
+		if f.Logger == nil && f.WithParams == nil {
+			args := append([]any{}, f.Attrs...)
+			if f.Cause != nil {
+				args = append(args, "error", f.Cause)
+			}
+			logger.Default().Error(f.Msg, args...)
+			return 1
+		}
+
 		var l *zerolog.Event
 		if f.Logger != nil {
 			l = f.Logger()
@@ -64,7 +78,7 @@ func HandleFatalError(err error) int {
 
 		l.Msg(f.Msg)
 	} else {
-		log.Error().Err(err).Msg(defaultMsg)
+		logger.Default().Error(defaultMsg, "error", err)
 	}
 	return 1
 }
@@ -21,7 +21,7 @@ import (
 	"time"
 
 	"github.com/mrsimonemms/golang-helpers/examples/grpc/basic/v1"
-	"github.com/sirupsen/logrus"
+	"github.com/mrsimonemms/golang-helpers/logger"
 	"google.golang.org/grpc"
 )
 
@@ -46,7 +46,7 @@ func (c *Commands) Command2(request *basic.Command2Request, srv grpc.ServerStrea
 	}
 
 	sleep := time.Second * 10
-	logrus.WithField("timeout", sleep).Info("Sleeping for effect")
+	logger.Default().Info("Sleeping for effect", "timeout", sleep)
 
 	time.Sleep(sleep)
 
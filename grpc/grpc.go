@@ -24,7 +24,6 @@ import (
 
 	golanghelpers "github.com/mrsimonemms/golang-helpers"
 	"github.com/mrsimonemms/golang-helpers/logger"
-	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/health"
@@ -47,8 +46,9 @@ type HealthCheckFn func(*health.Server) grpc_health_v1.HealthCheckResponse_Servi
 type ServerFactory func(server *grpc.Server)
 
 type Server struct {
-	RootCmd *cobra.Command
-	RunCmd  *cobra.Command
+	RootCmd  *cobra.Command
+	RunCmd   *cobra.Command
+	ShellCmd *cobra.Command
 }
 
 type Listener[T any] struct {
@@ -63,7 +63,7 @@ type StreamResponse[T any] struct {
 
 // Send is the only method on the StreamResponse. Any data received is sent directly to the terminal logger.
 func (f *StreamResponse[T]) Send(data *T) error {
-	logger.Log().WithField("data", data).Info("New stream data received")
+	logger.Default().Info("New stream data received", "data", data)
 	return nil
 }
 
@@ -77,7 +77,7 @@ func NewGRPCCommand[T any](s *Server, command string, f Listener[T]) *Server {
 				return err
 			}
 
-			logger.Log().WithField("response", res).Info("Command resolved successfully")
+			logger.Default().Info("Command resolved successfully", "response", res)
 			return nil
 		},
 	}
@@ -91,7 +91,7 @@ func NewGRPCCommand[T any](s *Server, command string, f Listener[T]) *Server {
 }
 
 func (s *Server) Execute() {
-	s.RootCmd.AddCommand(s.RunCmd)
+	s.RootCmd.AddCommand(s.RunCmd, s.ShellCmd)
 
 	err := s.RootCmd.Execute()
 	if err != nil {
@@ -111,18 +111,56 @@ func New(name, description string, serverFactory []ServerFactory, opts ...Option
 
 Any response from the command will be sent to the console. In production, this will be returned via gRPC.`,
 		},
+		ShellCmd: newShellCmd(serverFactory, opts...),
 	}
 }
 
+// newServer builds the gRPC server with reflection, health checks and the
+// services from the factories registered. The health check loops are returned
+// to the caller rather than started so that non-production commands can skip them.
+func newServer(
+	serverFactory []ServerFactory,
+	opts ...Options,
+) (*grpc.Server, *health.Server, map[string]HealthCheck, error) {
+	// The request-scoped logger is chained first so it wraps the other chained interceptors
+	serverOpts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(UnaryServerInterceptor()),
+		grpc.ChainStreamInterceptor(StreamServerInterceptor()),
+	}
+	healthchecks := map[string]HealthCheck{}
+	for _, o := range opts {
+		serverOpts = append(serverOpts, o.ServerOptions...)
+		for k, v := range o.HealthChecks {
+			if _, ok := healthchecks[k]; ok {
+				return nil, nil, nil, fmt.Errorf("health check already registered: %s", k)
+			}
+			healthchecks[k] = v
+		}
+	}
+
+	server := grpc.NewServer(serverOpts...)
+	// Register reflection service on gRPC server.
+	reflection.Register(server)
+
+	healthcheck := health.NewServer()
+	grpc_health_v1.RegisterHealthServer(server, healthcheck)
+
+	for _, factory := range serverFactory {
+		factory(server)
+	}
+
+	return server, healthcheck, healthchecks, nil
+}
+
 func newRootCmd(name, description string, serverFactory []ServerFactory, opts ...Options) *cobra.Command {
-	var logLevel string
+	var logOpts logger.LoggerOpts
 	var port int
 
 	rootCmd := &cobra.Command{
 		Use:   name,
 		Short: description,
 		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
-			return logger.SetLevel(logLevel)
+			return logger.Configure(logOpts)
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			//nolint:noctx
@@ -131,25 +169,11 @@ func newRootCmd(name, description string, serverFactory []ServerFactory, opts ..
 				return fmt.Errorf("failed to start listener: %w", err)
 			}
 
-			serverOpts := make([]grpc.ServerOption, 0)
-			healthchecks := map[string]HealthCheck{}
-			for _, o := range opts {
-				serverOpts = append(serverOpts, o.ServerOptions...)
-				for k, v := range o.HealthChecks {
-					if _, ok := healthchecks[k]; ok {
-						return fmt.Errorf("health check already registered: %s", k)
-					}
-					healthchecks[k] = v
-				}
+			server, healthcheck, healthchecks, err := newServer(serverFactory, opts...)
+			if err != nil {
+				return err
 			}
 
-			server := grpc.NewServer(serverOpts...)
-			// Register reflection service on gRPC server.
-			reflection.Register(server)
-
-			healthcheck := health.NewServer()
-			grpc_health_v1.RegisterHealthServer(server, healthcheck)
-
 			for service, check := range healthchecks {
 				go func() {
 					if check.Timeout == nil {
@@ -160,10 +184,11 @@ func newRootCmd(name, description string, serverFactory []ServerFactory, opts ..
 						// Run health check
 						status := check.Check(healthcheck)
 
-						l := logger.Log().
-							WithField("status", status).
-							WithField("service", service).
-							WithField("timeoout", check.Timeout)
+						l := logger.Default().With(
+							"status", status,
+							"service", service,
+							"timeout", check.Timeout,
+						)
 
 						if status == grpc_health_v1.HealthCheckResponse_SERVING {
 							l.Debug("Running health check")
@@ -178,22 +203,12 @@ func newRootCmd(name, description string, serverFactory []ServerFactory, opts ..
 				}()
 			}
 
-			for _, factory := range serverFactory {
-				factory(server)
-			}
-
-			logger.Log().WithField("address", lis.Addr()).Info("Server listening")
+			logger.Default().Info("Server listening", "address", lis.Addr())
 			return server.Serve(lis)
 		},
 	}
 
-	rootCmd.PersistentFlags().StringVarP(
-		&logLevel,
-		"log-level",
-		"l",
-		logrus.InfoLevel.String(),
-		fmt.Sprintf("log level: %s", logger.GetAllLevels()),
-	)
+	logger.NewCobraOpts(rootCmd, &logOpts)
 
 	rootCmd.Flags().IntVarP(&port, "port", "p", 3000, "The server port")
 
@@ -0,0 +1,125 @@
+/*
+ * Copyright 2023 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/mrsimonemms/golang-helpers/logger"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	var out bytes.Buffer
+	logger.UseHandler(slog.NewJSONHandler(&out, nil))
+	t.Cleanup(func() {
+		logger.UseZerolog(&log.Logger)
+	})
+
+	tests := []struct {
+		Name     string
+		MD       metadata.MD
+		Contains []string
+	}{
+		{
+			Name: "with metadata",
+			MD: metadata.Pairs(
+				RequestIDHeader, "req-123",
+				TraceParentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			),
+			Contains: []string{
+				`"requestId":"req-123"`,
+				`"traceId":"4bf92f3577b34da6a3ce929d0e0e4736"`,
+				`"grpcMethod":"/test.Service/Method"`,
+			},
+		},
+		{
+			Name: "generated request ID",
+			MD:   metadata.MD{},
+			Contains: []string{
+				`"requestId":"`,
+				`"grpcMethod":"/test.Service/Method"`,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			out.Reset()
+
+			ctx := metadata.NewIncomingContext(context.Background(), test.MD)
+			_, err := UnaryServerInterceptor()(ctx, nil, &grpc.UnaryServerInfo{
+				FullMethod: "/test.Service/Method",
+			}, func(ctx context.Context, req any) (any, error) {
+				logger.FromContext(ctx).Info("Handled")
+				return nil, nil
+			})
+
+			assert.NoError(t, err)
+			for _, c := range test.Contains {
+				assert.Contains(t, out.String(), c)
+			}
+		})
+	}
+}
+
+func TestUnaryServerInterceptorTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+	})
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		TraceParentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	))
+
+	var handlerSpan trace.SpanContext
+	_, err := UnaryServerInterceptor()(ctx, nil, &grpc.UnaryServerInfo{
+		FullMethod: "/test.Service/Method",
+	}, func(ctx context.Context, req any) (any, error) {
+		handlerSpan = trace.SpanContextFromContext(ctx)
+		return nil, errors.New("failed")
+	})
+	assert.Error(t, err)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+
+	span := spans[0]
+	assert.Equal(t, "/test.Service/Method", span.Name())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", span.Parent().SpanID().String())
+	assert.Equal(t, codes.Error, span.Status().Code)
+
+	// The handler's context carries the span, so calls it makes are children
+	assert.Equal(t, span.SpanContext().SpanID(), handlerSpan.SpanID())
+}
@@ -0,0 +1,800 @@
+/*
+ * Copyright 2023 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grpc
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const shellHelp = `Commands:
+  list [service]            List the services, or the methods of a service
+  describe <method>         Show the request and response fields of a method
+  call <method> [json]      Invoke a method. Client streams accept a JSON array
+  edit <method>             Edit the request in $EDITOR and invoke the method
+  history [n]               List the session history, or show entry n
+  help                      Show this help
+  exit                      Leave the shell
+`
+
+var shellCommands = []string{"call", "describe", "edit", "exit", "help", "history", "list"}
+
+type shellHistoryEntry struct {
+	Time      time.Time
+	Method    string
+	Request   string
+	Responses []string
+	Error     string
+}
+
+// shell is an interactive client that discovers the available methods via
+// the gRPC reflection service, so it works for in process and remote servers.
+type shell struct {
+	conn    grpc.ClientConnInterface
+	types   *dynamicpb.Types
+	methods map[string]protoreflect.MethodDescriptor
+	timeout time.Duration
+	history []shellHistoryEntry
+	out     io.Writer
+}
+
+func newShellCmd(serverFactory []ServerFactory, opts ...Options) *cobra.Command {
+	var remote string
+	var remoteTLS bool
+	var timeout time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "shell",
+		Short: "Open an interactive prompt to list and invoke the gRPC methods",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var conn *grpc.ClientConn
+			var err error
+			if remote == "" {
+				var stop func()
+				conn, stop, err = dialInProcess(serverFactory, opts...)
+				if err != nil {
+					return err
+				}
+				defer stop()
+			} else {
+				conn, err = dialRemote(remote, remoteTLS)
+				if err != nil {
+					return err
+				}
+			}
+			defer func() {
+				_ = conn.Close()
+			}()
+
+			s, err := newShell(cmd.Context(), conn, cmd.OutOrStdout(), timeout)
+			if err != nil {
+				return err
+			}
+
+			return s.Run(cmd.Context(), os.Stdin)
+		},
+	}
+
+	cmd.Flags().StringVar(&remote, "remote", "", "Address of a remote gRPC server. If empty, the server is run in process")
+	cmd.Flags().BoolVar(&remoteTLS, "remote-tls", false, "Use TLS when connecting to the remote server")
+	cmd.Flags().DurationVar(&timeout, "timeout", time.Second*30, "Timeout for each invocation")
+
+	return cmd
+}
+
+// dialInProcess starts the server on an in-memory listener and connects to it
+func dialInProcess(serverFactory []ServerFactory, opts ...Options) (*grpc.ClientConn, func(), error) {
+	server, _, _, err := newServer(serverFactory, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	lis := bufconn.Listen(1024 * 1024)
+	go func() {
+		_ = server.Serve(lis)
+	}()
+
+	conn, err := grpc.NewClient(
+		"passthrough:///in-process",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		server.Stop()
+		return nil, nil, fmt.Errorf("error connecting to in process server: %w", err)
+	}
+
+	return conn, server.Stop, nil
+}
+
+func dialRemote(address string, useTLS bool) (*grpc.ClientConn, error) {
+	creds := insecure.NewCredentials()
+	if useTLS {
+		creds = credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+	}
+
+	conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to remote server: %w", err)
+	}
+	return conn, nil
+}
+
+func newShell(ctx context.Context, conn grpc.ClientConnInterface, out io.Writer, timeout time.Duration) (*shell, error) {
+	files, err := loadDescriptors(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &shell{
+		conn:    conn,
+		types:   dynamicpb.NewTypes(files),
+		methods: map[string]protoreflect.MethodDescriptor{},
+		timeout: timeout,
+		out:     out,
+	}
+
+	files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		services := fd.Services()
+		for i := 0; i < services.Len(); i++ {
+			// The reflection service is an implementation detail of the shell
+			if strings.HasPrefix(string(services.Get(i).FullName()), "grpc.reflection.") {
+				continue
+			}
+			methods := services.Get(i).Methods()
+			for j := 0; j < methods.Len(); j++ {
+				m := methods.Get(j)
+				s.methods[methodName(m)] = m
+			}
+		}
+		return true
+	})
+
+	return s, nil
+}
+
+// loadDescriptors asks the reflection service for every exposed service and
+// the files, including dependencies, that describe them
+func loadDescriptors(ctx context.Context, conn grpc.ClientConnInterface) (*protoregistry.Files, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := grpc_reflection_v1.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error opening reflection stream: %w", err)
+	}
+	defer func() {
+		_ = stream.CloseSend()
+	}()
+
+	send := func(req *grpc_reflection_v1.ServerReflectionRequest) (*grpc_reflection_v1.ServerReflectionResponse, error) {
+		if err := stream.Send(req); err != nil {
+			return nil, fmt.Errorf("error sending reflection request: %w", err)
+		}
+		res, err := stream.Recv()
+		if err != nil {
+			return nil, fmt.Errorf("error receiving reflection response: %w", err)
+		}
+		if e := res.GetErrorResponse(); e != nil {
+			return nil, fmt.Errorf("reflection error: %s", e.GetErrorMessage())
+		}
+		return res, nil
+	}
+
+	files := map[string]*descriptorpb.FileDescriptorProto{}
+	addFiles := func(res *grpc_reflection_v1.ServerReflectionResponse) error {
+		for _, raw := range res.GetFileDescriptorResponse().GetFileDescriptorProto() {
+			fdp := new(descriptorpb.FileDescriptorProto)
+			if err := proto.Unmarshal(raw, fdp); err != nil {
+				return fmt.Errorf("error decoding file descriptor: %w", err)
+			}
+			files[fdp.GetName()] = fdp
+		}
+		return nil
+	}
+
+	res, err := send(&grpc_reflection_v1.ServerReflectionRequest{
+		MessageRequest: &grpc_reflection_v1.ServerReflectionRequest_ListServices{},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, svc := range res.GetListServicesResponse().GetService() {
+		res, err := send(&grpc_reflection_v1.ServerReflectionRequest{
+			MessageRequest: &grpc_reflection_v1.ServerReflectionRequest_FileContainingSymbol{
+				FileContainingSymbol: svc.GetName(),
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := addFiles(res); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := resolveDependencies(files, send, addFiles); err != nil {
+		return nil, err
+	}
+
+	set := &descriptorpb.FileDescriptorSet{}
+	for _, fdp := range files {
+		set.File = append(set.File, fdp)
+	}
+
+	reg, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, fmt.Errorf("error building descriptors: %w", err)
+	}
+	return reg, nil
+}
+
+// resolveDependencies asks for any imported files missing from the set, as
+// servers may not send every dependency with the service's file
+func resolveDependencies(
+	files map[string]*descriptorpb.FileDescriptorProto,
+	send func(*grpc_reflection_v1.ServerReflectionRequest) (*grpc_reflection_v1.ServerReflectionResponse, error),
+	addFiles func(*grpc_reflection_v1.ServerReflectionResponse) error,
+) error {
+	for {
+		missing := make([]string, 0)
+		for _, fdp := range files {
+			for _, dep := range fdp.GetDependency() {
+				if _, ok := files[dep]; !ok {
+					missing = append(missing, dep)
+				}
+			}
+		}
+		if len(missing) == 0 {
+			break
+		}
+
+		for _, name := range missing {
+			if _, ok := files[name]; ok {
+				continue
+			}
+			res, err := send(&grpc_reflection_v1.ServerReflectionRequest{
+				MessageRequest: &grpc_reflection_v1.ServerReflectionRequest_FileByFilename{
+					FileByFilename: name,
+				},
+			})
+			if err != nil {
+				return err
+			}
+			if err := addFiles(res); err != nil {
+				return err
+			}
+			if _, ok := files[name]; !ok {
+				return fmt.Errorf("reflection did not return file: %s", name)
+			}
+		}
+	}
+
+	return nil
+}
+
+func methodName(m protoreflect.MethodDescriptor) string {
+	return fmt.Sprintf("%s/%s", m.Parent().FullName(), m.Name())
+}
+
+// Run reads commands until the input ends or the user exits. If the input is a
+// terminal, it gets line editing, history and tab completion.
+func (s *shell) Run(ctx context.Context, in *os.File) error {
+	fd := int(in.Fd()) //nolint:gosec // File descriptors fit in an int
+	if !term.IsTerminal(fd) {
+		scanner := bufio.NewScanner(in)
+		for scanner.Scan() {
+			if !s.exec(ctx, scanner.Text()) {
+				return nil
+			}
+		}
+		return scanner.Err()
+	}
+
+	t := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{in, s.out}, "> ")
+	t.AutoCompleteCallback = s.complete
+
+	_, _ = fmt.Fprint(s.out, shellHelp)
+
+	for {
+		// Only use raw mode while reading so that commands and $EDITOR behave normally
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			return fmt.Errorf("error configuring terminal: %w", err)
+		}
+		line, err := t.ReadLine()
+		_ = term.Restore(fd, state)
+
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if !s.exec(ctx, line) {
+			return nil
+		}
+	}
+}
+
+// exec runs a single command, returning false when the shell should exit
+func (s *shell) exec(ctx context.Context, line string) bool {
+	cmd, rest, _ := strings.Cut(strings.TrimSpace(line), " ")
+	rest = strings.TrimSpace(rest)
+
+	var err error
+	switch cmd {
+	case "":
+	case "exit", "quit":
+		return false
+	case "help":
+		_, _ = fmt.Fprint(s.out, shellHelp)
+	case "list":
+		err = s.list(rest)
+	case "describe":
+		err = s.describe(rest)
+	case "call":
+		method, body, _ := strings.Cut(rest, " ")
+		err = s.call(ctx, method, body)
+	case "edit":
+		err = s.edit(ctx, rest)
+	case "history":
+		err = s.showHistory(rest)
+	default:
+		err = fmt.Errorf("unknown command: %s", cmd)
+	}
+
+	if err != nil {
+		_, _ = fmt.Fprintf(s.out, "Error: %s\n", err)
+	}
+	return true
+}
+
+func (s *shell) methodNames() []string {
+	names := make([]string, 0, len(s.methods))
+	for name := range s.methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *shell) serviceNames() []string {
+	seen := map[string]bool{}
+	names := make([]string, 0)
+	for _, m := range s.methods {
+		name := string(m.Parent().FullName())
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// findMethod accepts "pkg.Service/Method", "pkg.Service.Method" or a method
+// name on its own if it is unique across all services
+func (s *shell) findMethod(name string) (protoreflect.MethodDescriptor, error) {
+	if name == "" {
+		return nil, fmt.Errorf("method name required")
+	}
+	if m, ok := s.methods[name]; ok {
+		return m, nil
+	}
+
+	var found protoreflect.MethodDescriptor
+	for _, m := range s.methods {
+		if string(m.FullName()) == name || string(m.Name()) == name {
+			if found != nil {
+				return nil, fmt.Errorf("method name is ambiguous: %s", name)
+			}
+			found = m
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("unknown method: %s", name)
+	}
+	return found, nil
+}
+
+func (s *shell) list(service string) error {
+	if service == "" {
+		for _, name := range s.serviceNames() {
+			_, _ = fmt.Fprintln(s.out, name)
+		}
+		return nil
+	}
+
+	found := false
+	for _, name := range s.methodNames() {
+		m := s.methods[name]
+		if string(m.Parent().FullName()) != service {
+			continue
+		}
+		found = true
+		_, _ = fmt.Fprintf(s.out, "%s(%s) returns (%s)\n", name, streamName(m.IsStreamingClient(), m.Input()),
+			streamName(m.IsStreamingServer(), m.Output()))
+	}
+	if !found {
+		return fmt.Errorf("unknown service: %s", service)
+	}
+	return nil
+}
+
+func streamName(stream bool, msg protoreflect.MessageDescriptor) string {
+	if stream {
+		return "stream " + string(msg.FullName())
+	}
+	return string(msg.FullName())
+}
+
+func (s *shell) describe(name string) error {
+	m, err := s.findMethod(name)
+	if err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintf(s.out, "%s(%s) returns (%s)\n", methodName(m), streamName(m.IsStreamingClient(), m.Input()),
+		streamName(m.IsStreamingServer(), m.Output()))
+
+	for _, msg := range []protoreflect.MessageDescriptor{m.Input(), m.Output()} {
+		_, _ = fmt.Fprintf(s.out, "\nmessage %s {\n", msg.FullName())
+		fields := msg.Fields()
+		for i := 0; i < fields.Len(); i++ {
+			f := fields.Get(i)
+			kind := f.Kind().String()
+			switch {
+			case f.Message() != nil:
+				kind = string(f.Message().FullName())
+			case f.Enum() != nil:
+				kind = string(f.Enum().FullName())
+			}
+			if f.IsList() {
+				kind = "repeated " + kind
+			}
+			_, _ = fmt.Fprintf(s.out, "  %s %s = %d; // json: %s\n", kind, f.Name(), f.Number(), f.JSONName())
+		}
+		_, _ = fmt.Fprintln(s.out, "}")
+	}
+	return nil
+}
+
+func (s *shell) call(ctx context.Context, name, body string) error {
+	m, err := s.findMethod(name)
+	if err != nil {
+		return err
+	}
+
+	entry := shellHistoryEntry{
+		Time:    time.Now(),
+		Method:  methodName(m),
+		Request: strings.TrimSpace(body),
+	}
+	if entry.Request == "" {
+		entry.Request = "{}"
+	}
+
+	err = s.invoke(ctx, m, entry.Request, func(res string) {
+		entry.Responses = append(entry.Responses, res)
+		_, _ = fmt.Fprintln(s.out, res)
+	})
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	s.history = append(s.history, entry)
+
+	return err
+}
+
+// invoke sends the JSON request to the method, calling onResponse for every
+// message received so streamed responses are shown as they arrive
+func (s *shell) invoke(ctx context.Context, m protoreflect.MethodDescriptor, body string, onResponse func(string)) error {
+	bodies := []json.RawMessage{json.RawMessage(body)}
+	if m.IsStreamingClient() && strings.HasPrefix(body, "[") {
+		if err := json.Unmarshal([]byte(body), &bodies); err != nil {
+			return fmt.Errorf("error parsing request list: %w", err)
+		}
+	}
+
+	requests := make([]proto.Message, 0, len(bodies))
+	for _, b := range bodies {
+		req := dynamicpb.NewMessage(m.Input())
+		if err := (protojson.UnmarshalOptions{Resolver: s.types}).Unmarshal(b, req); err != nil {
+			return fmt.Errorf("error parsing request: %w", err)
+		}
+		requests = append(requests, req)
+	}
+
+	marshal := protojson.MarshalOptions{Multiline: true, Indent: "  ", Resolver: s.types}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	fullMethod := "/" + methodName(m)
+
+	if !m.IsStreamingClient() && !m.IsStreamingServer() {
+		res := dynamicpb.NewMessage(m.Output())
+		if err := s.conn.Invoke(ctx, fullMethod, requests[0], res); err != nil {
+			return err
+		}
+		onResponse(marshal.Format(res))
+		return nil
+	}
+
+	stream, err := s.conn.NewStream(ctx, &grpc.StreamDesc{
+		ServerStreams: m.IsStreamingServer(),
+		ClientStreams: m.IsStreamingClient(),
+	}, fullMethod)
+	if err != nil {
+		return err
+	}
+
+	for _, req := range requests {
+		if err := stream.SendMsg(req); err != nil {
+			return err
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		return err
+	}
+
+	for {
+		res := dynamicpb.NewMessage(m.Output())
+		if err := stream.RecvMsg(res); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		onResponse(marshal.Format(res))
+	}
+}
+
+// edit opens the last request for the method, or an empty template, in the
+// user's editor and invokes the method with the result
+func (s *shell) edit(ctx context.Context, name string) error {
+	m, err := s.findMethod(name)
+	if err != nil {
+		return err
+	}
+
+	template := ""
+	for i := len(s.history) - 1; i >= 0; i-- {
+		if s.history[i].Method == methodName(m) {
+			template = s.history[i].Request
+			break
+		}
+	}
+	if template == "" {
+		template = protojson.MarshalOptions{
+			Multiline:       true,
+			Indent:          "  ",
+			EmitUnpopulated: true,
+		}.Format(dynamicpb.NewMessage(m.Input()))
+	}
+
+	f, err := os.CreateTemp("", "grpc-shell-*.json")
+	if err != nil {
+		return fmt.Errorf("error creating request file: %w", err)
+	}
+	defer func() {
+		_ = os.Remove(f.Name())
+	}()
+
+	if _, err := f.WriteString(template); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("error writing request file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("error writing request file: %w", err)
+	}
+
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "vi"
+	}
+
+	//nolint:gosec // The editor is chosen by the user running the shell
+	c := exec.CommandContext(ctx, editor, f.Name())
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("error running editor: %w", err)
+	}
+
+	body, err := os.ReadFile(f.Name())
+	if err != nil {
+		return fmt.Errorf("error reading request file: %w", err)
+	}
+
+	return s.call(ctx, methodName(m), string(body))
+}
+
+func (s *shell) showHistory(arg string) error {
+	if arg == "" {
+		for i, h := range s.history {
+			status := "ok"
+			if h.Error != "" {
+				status = "error"
+			}
+			_, _ = fmt.Fprintf(s.out, "%d\t%s\t%s\t%s\n", i+1, h.Time.Format(time.TimeOnly), h.Method, status)
+		}
+		return nil
+	}
+
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 1 || n > len(s.history) {
+		return fmt.Errorf("unknown history entry: %s", arg)
+	}
+
+	h := s.history[n-1]
+	_, _ = fmt.Fprintf(s.out, "Method: %s\nRequest:\n%s\n", h.Method, h.Request)
+	for _, res := range h.Responses {
+		_, _ = fmt.Fprintf(s.out, "Response:\n%s\n", res)
+	}
+	if h.Error != "" {
+		_, _ = fmt.Fprintf(s.out, "Error: %s\n", h.Error)
+	}
+	return nil
+}
+
+// complete is the tab completion for the terminal. It completes commands,
+// then service and method names, then the JSON field names of the request.
+func (s *shell) complete(line string, pos int, key rune) (newLine string, newPos int, ok bool) {
+	if key != '\t' {
+		return "", 0, false
+	}
+
+	prefix := line[:pos]
+	words := strings.Fields(prefix)
+	if strings.HasSuffix(prefix, " ") {
+		words = append(words, "")
+	}
+
+	var candidates []string
+	var word string
+	switch {
+	case len(words) <= 1:
+		candidates = shellCommands
+		word = strings.TrimSpace(prefix)
+	case len(words) == 2 && words[0] == "list":
+		candidates = s.serviceNames()
+		word = words[1]
+	case len(words) == 2 && (words[0] == "call" || words[0] == "describe" || words[0] == "edit"):
+		candidates = s.methodNames()
+		word = words[1]
+	case words[0] == "call":
+		return s.completeField(line, pos, words[1])
+	default:
+		return "", 0, false
+	}
+
+	completion := commonPrefix(word, candidates)
+	if completion == "" {
+		return "", 0, false
+	}
+	return prefix + completion + line[pos:], pos + len(completion), true
+}
+
+// completeField completes the partially typed JSON key before the cursor
+func (s *shell) completeField(line string, pos int, method string) (newLine string, newPos int, ok bool) {
+	m, err := s.findMethod(method)
+	if err != nil {
+		return "", 0, false
+	}
+
+	start := pos
+	for start > 0 && isFieldChar(line[start-1]) {
+		start--
+	}
+	word := line[start:pos]
+	quoted := start > 0 && line[start-1] == '"'
+
+	fields := m.Input().Fields()
+	candidates := make([]string, 0, fields.Len())
+	for i := 0; i < fields.Len(); i++ {
+		candidates = append(candidates, fields.Get(i).JSONName())
+	}
+
+	completion := commonPrefix(word, candidates)
+	if completion == "" && !matchesOne(word, candidates) {
+		return "", 0, false
+	}
+
+	insert := completion
+	if matchesOne(word+completion, candidates) {
+		// Close the key off when there's only one possible field
+		insert += `": `
+		if !quoted {
+			return line[:start] + `"` + word + insert + line[pos:], pos + len(insert) + 1, true
+		}
+	}
+	return line[:pos] + insert + line[pos:], pos + len(insert), true
+}
+
+func isFieldChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func matchesOne(word string, candidates []string) bool {
+	n := 0
+	for _, c := range candidates {
+		if strings.HasPrefix(c, word) {
+			n++
+		}
+	}
+	return n == 1
+}
+
+// commonPrefix returns the text to append to word that all matching candidates share
+func commonPrefix(word string, candidates []string) string {
+	var prefix string
+	found := false
+	for _, c := range candidates {
+		if !strings.HasPrefix(c, word) {
+			continue
+		}
+		if !found {
+			prefix = c
+			found = true
+			continue
+		}
+		for !strings.HasPrefix(c, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	if !found {
+		return ""
+	}
+	return prefix[len(word):]
+}
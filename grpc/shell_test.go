@@ -0,0 +1,119 @@
+/*
+ * Copyright 2023 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestShell(t *testing.T) (*shell, *bytes.Buffer) {
+	t.Helper()
+
+	conn, stop, err := dialInProcess(nil)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = conn.Close()
+		stop()
+	})
+
+	out := new(bytes.Buffer)
+	s, err := newShell(context.Background(), conn, out, time.Second*5)
+	require.NoError(t, err)
+
+	return s, out
+}
+
+func TestShellListAndCall(t *testing.T) {
+	s, out := newTestShell(t)
+
+	assert.True(t, s.exec(context.Background(), "list"))
+	assert.Contains(t, out.String(), "grpc.health.v1.Health")
+	assert.NotContains(t, out.String(), "ServerReflection")
+
+	out.Reset()
+	assert.True(t, s.exec(context.Background(), `call Check {"service": ""}`))
+	assert.Regexp(t, `"status":\s+"SERVING"`, out.String())
+
+	out.Reset()
+	assert.True(t, s.exec(context.Background(), `call Check {"unknown": true}`))
+	assert.Contains(t, out.String(), "Error: error parsing request")
+
+	require.Len(t, s.history, 2)
+	assert.Equal(t, "grpc.health.v1.Health/Check", s.history[0].Method)
+	assert.Len(t, s.history[0].Responses, 1)
+	assert.NotEmpty(t, s.history[1].Error)
+
+	assert.False(t, s.exec(context.Background(), "exit"))
+}
+
+func TestShellComplete(t *testing.T) {
+	s, _ := newTestShell(t)
+
+	tests := []struct {
+		Name string
+		Line string
+		Want string
+		OK   bool
+	}{
+		{
+			Name: "command",
+			Line: "hi",
+			Want: "history",
+			OK:   true,
+		},
+		{
+			Name: "method",
+			Line: "call grpc.health.v1.Health/Ch",
+			Want: "call grpc.health.v1.Health/Check",
+			OK:   true,
+		},
+		{
+			Name: "unquoted field",
+			Line: "call Check {se",
+			Want: `call Check {"service": `,
+			OK:   true,
+		},
+		{
+			Name: "quoted field",
+			Line: `call Check {"se`,
+			Want: `call Check {"service": `,
+			OK:   true,
+		},
+		{
+			Name: "no match",
+			Line: "call Check {zz",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			line, pos, ok := s.complete(test.Line, len(test.Line), '\t')
+
+			assert.Equal(t, test.OK, ok)
+			if test.OK {
+				assert.Equal(t, test.Want, line)
+				assert.Equal(t, len(test.Want), pos)
+			}
+		})
+	}
+}
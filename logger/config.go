@@ -0,0 +1,237 @@
+/*
+ * Copyright 2023 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package logger
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+type Format string
+
+const (
+	// FormatAuto uses FormatPretty in an interactive terminal and FormatJSON otherwise
+	FormatAuto   Format = "auto"
+	FormatJSON   Format = "json"
+	FormatText   Format = "text"
+	FormatPretty Format = "pretty"
+)
+
+type Output string
+
+const (
+	OutputStderr Output = "stderr"
+	OutputStdout Output = "stdout"
+	OutputFile   Output = "file"
+)
+
+type LoggerOpts struct {
+	Level  string
+	Format Format
+	Output Output
+	// File is the path written to when Output is OutputFile
+	File string
+	// SampleRate is the fraction of records below warning level that are
+	// logged. Zero or one logs everything.
+	SampleRate float64
+}
+
+var (
+	outputMu sync.Mutex
+	// outputFile is kept so it can be closed if Configure is called again
+	outputFile *os.File
+)
+
+// Configure sets up the shared logger, and the global zerolog and logrus
+// instances, with the level, format and output given. Nothing is changed if
+// the options are invalid.
+func Configure(opts LoggerOpts) error {
+	if opts.Level != "" {
+		if _, err := logrus.ParseLevel(opts.Level); err != nil {
+			return err
+		}
+	}
+
+	if opts.SampleRate < 0 || opts.SampleRate > 1 {
+		return fmt.Errorf("log sample rate must be between 0 and 1: %v", opts.SampleRate)
+	}
+
+	switch opts.Format {
+	case "", FormatAuto, FormatJSON, FormatText, FormatPretty:
+	default:
+		return fmt.Errorf("unknown log format: %s", opts.Format)
+	}
+
+	w, err := openOutput(opts.Output, opts.File)
+	if err != nil {
+		return err
+	}
+
+	if opts.Level != "" {
+		if err := SetLevel(opts.Level); err != nil {
+			return err
+		}
+	}
+
+	format := opts.Format
+	if format == "" || format == FormatAuto {
+		format = FormatJSON
+		if f, ok := w.(*os.File); ok && isTerminal(f) {
+			format = FormatPretty
+		}
+	}
+
+	var zw io.Writer
+	switch format {
+	case FormatJSON:
+		zw = w
+		Logger.SetFormatter(&logrus.JSONFormatter{})
+	case FormatText:
+		zw = zerolog.ConsoleWriter{Out: w, NoColor: true, TimeFormat: time.RFC3339}
+		Logger.SetFormatter(&logrus.TextFormatter{DisableColors: true, FullTimestamp: true})
+	case FormatPretty:
+		zw = zerolog.ConsoleWriter{Out: w, TimeFormat: time.Kitchen}
+		Logger.SetFormatter(&logrus.TextFormatter{ForceColors: true, FullTimestamp: true})
+	}
+	Logger.SetOutput(w)
+
+	log.Logger = zerolog.New(zw).With().Timestamp().Logger()
+
+	UseZerolog(&log.Logger)
+	if opts.SampleRate > 0 && opts.SampleRate < 1 {
+		UseHandler(newSamplingHandler(*backend.Load(), opts.SampleRate))
+	}
+
+	return nil
+}
+
+// NewCobraOpts registers the logging flags as persistent flags on the command.
+// Call Configure with the result before anything is logged, usually in
+// PersistentPreRunE.
+func NewCobraOpts(cmd *cobra.Command, opts *LoggerOpts) *LoggerOpts {
+	cmd.PersistentFlags().StringVarP(
+		&opts.Level, "log-level", "l",
+		logrus.InfoLevel.String(), fmt.Sprintf("log level: %s", GetAllLevels()),
+	)
+
+	cmd.PersistentFlags().StringVar(
+		(*string)(&opts.Format), "log-format",
+		string(FormatAuto), fmt.Sprintf("log format: %s, %s, %s or %s", FormatAuto, FormatJSON, FormatText, FormatPretty),
+	)
+
+	cmd.PersistentFlags().StringVar(
+		(*string)(&opts.Output), "log-output",
+		string(OutputStderr), fmt.Sprintf("log output: %s, %s or %s", OutputStderr, OutputStdout, OutputFile),
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&opts.File, "log-file",
+		"", fmt.Sprintf("Path of the log file when the output is %s", OutputFile),
+	)
+
+	opts.SampleRate = 1
+	cmd.PersistentFlags().Var(
+		(*sampleRateValue)(&opts.SampleRate), "log-sample-rate",
+		"Fraction of logs below warning level to keep, above 0 and up to 1",
+	)
+
+	return opts
+}
+
+// sampleRateValue is a flag that rejects 0, as LoggerOpts treats that as
+// logging everything rather than dropping it
+type sampleRateValue float64
+
+func (s *sampleRateValue) Set(v string) error {
+	rate, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return err
+	}
+	if rate <= 0 || rate > 1 {
+		return fmt.Errorf("log sample rate must be above 0 and up to 1: %v", rate)
+	}
+
+	*s = sampleRateValue(rate)
+	return nil
+}
+
+func (s *sampleRateValue) String() string {
+	return strconv.FormatFloat(float64(*s), 'g', -1, 64)
+}
+
+func (s *sampleRateValue) Type() string {
+	return "float64"
+}
+
+func openOutput(output Output, file string) (io.Writer, error) {
+	outputMu.Lock()
+	defer outputMu.Unlock()
+
+	var w io.Writer
+	switch output {
+	case "", OutputStderr:
+		w = os.Stderr
+	case OutputStdout:
+		w = os.Stdout
+	case OutputFile:
+		if file == "" {
+			return nil, fmt.Errorf("log file path required for output: %s", output)
+		}
+		f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600) //nolint:gosec // The path is set by the operator
+		if err != nil {
+			return nil, fmt.Errorf("error opening log file: %w", err)
+		}
+		w = f
+	default:
+		return nil, fmt.Errorf("unknown log output: %s", output)
+	}
+
+	if outputFile != nil {
+		_ = outputFile.Close()
+		outputFile = nil
+	}
+	if f, ok := w.(*os.File); ok && output == OutputFile {
+		outputFile = f
+	}
+
+	return w, nil
+}
+
+// isTerminal mirrors golanghelpers.IsTerminal, which can't be used here as
+// that package depends on this one
+func isTerminal(f *os.File) bool {
+	if _, ok := os.LookupEnv("CI"); ok {
+		return false
+	}
+
+	fd := f.Fd()
+	if fd > math.MaxInt {
+		return false
+	}
+	return term.IsTerminal(int(fd))
+}
@@ -0,0 +1,55 @@
+/*
+ * Copyright 2023 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package logger
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Field names for request-scoped metadata, so that every package correlates
+// log lines with the same keys
+const (
+	KeyRequestID    = "requestId"
+	KeyTraceID      = "traceId"
+	KeyGRPCMethod   = "grpcMethod"
+	KeyWorkflowID   = "workflowId"
+	KeyWorkflowType = "workflowType"
+	KeyRunID        = "runId"
+	KeyActivityID   = "activityId"
+	KeyActivityType = "activityType"
+	KeyTaskQueue    = "taskQueue"
+	KeyNamespace    = "namespace"
+)
+
+type contextKey struct{}
+
+// WithContext returns a copy of the context carrying a child of its logger
+// with the key/value pairs added. If the context has no logger, a child of
+// the shared logger is used.
+func WithContext(ctx context.Context, args ...any) context.Context {
+	return context.WithValue(ctx, contextKey{}, FromContext(ctx).With(args...))
+}
+
+// FromContext returns the logger carried by the context, or the shared
+// logger if there isn't one
+func FromContext(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return Default()
+}
@@ -0,0 +1,68 @@
+/*
+ * Copyright 2023 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package logger
+
+import (
+	"context"
+	"log/slog"
+)
+
+// dynamicHandler forwards to whichever backend is configured when the record
+// is handled. Attributes and groups are replayed onto the backend, so child
+// loggers created before a backend change still follow it. Everything is
+// redacted before it reaches the backend.
+type dynamicHandler struct {
+	ops []func(slog.Handler) slog.Handler
+}
+
+func (h *dynamicHandler) handler() slog.Handler {
+	hd := *backend.Load()
+	for _, op := range h.ops {
+		hd = op(hd)
+	}
+	return hd
+}
+
+func (h *dynamicHandler) with(op func(slog.Handler) slog.Handler) *dynamicHandler {
+	ops := make([]func(slog.Handler) slog.Handler, 0, len(h.ops)+1)
+	ops = append(ops, h.ops...)
+	return &dynamicHandler{ops: append(ops, op)}
+}
+
+func (h *dynamicHandler) Enabled(ctx context.Context, l slog.Level) bool {
+	return l >= level.Level() && (*backend.Load()).Enabled(ctx, l)
+}
+
+func (h *dynamicHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.handler().Handle(ctx, redact.record(r))
+}
+
+func (h *dynamicHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	attrs = redact.attrs(attrs)
+	return h.with(func(hd slog.Handler) slog.Handler {
+		return hd.WithAttrs(attrs)
+	})
+}
+
+func (h *dynamicHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return h.with(func(hd slog.Handler) slog.Handler {
+		return hd.WithGroup(name)
+	})
+}
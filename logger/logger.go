@@ -17,17 +17,80 @@
 package logger
 
 import (
+	"context"
+	"log/slog"
+	"os"
 	"strings"
+	"sync/atomic"
 
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	slogzerolog "github.com/samber/slog-zerolog/v2"
 	"github.com/sirupsen/logrus"
 )
 
-// Logger is default instance of logger used in all other packages
-// instead of global scope logrus.Logger.
+// Levels that exist in logrus and zerolog, but not in slog
+const (
+	LevelTrace = slog.Level(-8)
+	LevelFatal = slog.Level(12)
+	LevelPanic = slog.Level(16)
+)
+
+// Logger is the logrus instance used by the logrus backend.
+//
+// Deprecated: use Default, which writes to the configured backend.
 var Logger *logrus.Logger
 
+var (
+	// level is shared by every backend so SetLevel applies everywhere
+	level = new(slog.LevelVar)
+
+	// backend is the handler that the default logger currently writes to
+	backend atomic.Pointer[slog.Handler]
+
+	defaultLogger = slog.New(&dynamicHandler{})
+)
+
 func init() {
 	Logger = logrus.New()
+
+	slogzerolog.LogLevels[LevelTrace] = zerolog.TraceLevel
+	slogzerolog.LogLevels[LevelFatal] = zerolog.FatalLevel
+	slogzerolog.LogLevels[LevelPanic] = zerolog.PanicLevel
+
+	// Use the global zerolog instance by reference so replacing it is honoured
+	UseZerolog(&log.Logger)
+}
+
+// Default returns the shared logger. It always writes to the backend set by
+// the most recent Use call, even if it was retrieved before that call.
+func Default() *slog.Logger {
+	return defaultLogger
+}
+
+// Fatal logs the message at fatal level and exits the program
+func Fatal(msg string, args ...any) {
+	defaultLogger.Log(context.Background(), LevelFatal, msg, args...)
+	os.Exit(1)
+}
+
+// UseHandler sends the shared logger's output to any slog handler. The
+// shared level is applied on top of the handler's own level.
+func UseHandler(h slog.Handler) {
+	backend.Store(&h)
+}
+
+// UseLogrus sends the shared logger's output to a logrus instance
+func UseLogrus(l *logrus.Logger) {
+	UseHandler(newLogrusHandler(l, level))
+}
+
+// UseZerolog sends the shared logger's output to a zerolog instance
+func UseZerolog(l *zerolog.Logger) {
+	UseHandler(slogzerolog.Option{
+		Level:  level,
+		Logger: l,
+	}.NewZerologHandler())
 }
 
 func GetAllLevels() string {
@@ -43,17 +106,61 @@ func GetAllLevels() string {
 	return strings.Join(l, ", ")
 }
 
+// SetLevel sets the level of the shared logger and of the logrus and zerolog
+// instances, so code using any of them directly is consistent
 func SetLevel(logLevel string) error {
-	level, err := logrus.ParseLevel(logLevel)
+	l, err := logrus.ParseLevel(logLevel)
 	if err != nil {
 		return err
 	}
 
-	Logger.SetLevel(level)
+	Logger.SetLevel(l)
+	level.Set(fromLogrusLevel(l))
+	zerolog.SetGlobalLevel(slogzerolog.LogLevels[fromLogrusLevel(l)])
+
 	return nil
 }
 
-// Log is used to return the default Logger.
+// Log is used to return the logrus Logger.
+//
+// Deprecated: use Default, which writes to the configured backend.
 func Log() *logrus.Logger {
 	return Logger
 }
+
+func fromLogrusLevel(l logrus.Level) slog.Level {
+	switch l {
+	case logrus.PanicLevel:
+		return LevelPanic
+	case logrus.FatalLevel:
+		return LevelFatal
+	case logrus.ErrorLevel:
+		return slog.LevelError
+	case logrus.WarnLevel:
+		return slog.LevelWarn
+	case logrus.InfoLevel:
+		return slog.LevelInfo
+	case logrus.DebugLevel:
+		return slog.LevelDebug
+	default:
+		return LevelTrace
+	}
+}
+
+func toLogrusLevel(l slog.Level) logrus.Level {
+	switch {
+	case l >= LevelFatal:
+		// Logging at panic level makes logrus panic, so cap it at fatal
+		return logrus.FatalLevel
+	case l >= slog.LevelError:
+		return logrus.ErrorLevel
+	case l >= slog.LevelWarn:
+		return logrus.WarnLevel
+	case l >= slog.LevelInfo:
+		return logrus.InfoLevel
+	case l >= slog.LevelDebug:
+		return logrus.DebugLevel
+	default:
+		return logrus.TraceLevel
+	}
+}
@@ -0,0 +1,165 @@
+/*
+ * Copyright 2023 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package logger_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mrsimonemms/golang-helpers/logger"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackends(t *testing.T) {
+	t.Cleanup(func() {
+		logger.UseZerolog(&log.Logger)
+		require.NoError(t, logger.SetLevel(logrus.InfoLevel.String()))
+	})
+
+	// Retrieve the logger before the backend is configured
+	l := logger.Default().With("service", "test").WithGroup("req")
+
+	var logrusOut bytes.Buffer
+	lr := logrus.New()
+	lr.SetOutput(&logrusOut)
+	lr.SetFormatter(&logrus.JSONFormatter{})
+	logger.UseLogrus(lr)
+
+	require.NoError(t, logger.SetLevel(logrus.WarnLevel.String()))
+	l.Info("hidden")
+	assert.Empty(t, logrusOut.String())
+
+	l.Warn("shown", "id", 123)
+	assert.Contains(t, logrusOut.String(), `"msg":"shown"`)
+	assert.Contains(t, logrusOut.String(), `"service":"test"`)
+	assert.Contains(t, logrusOut.String(), `"req.id":123`)
+
+	var zerologOut bytes.Buffer
+	zl := zerolog.New(&zerologOut)
+	logger.UseZerolog(&zl)
+
+	logrusOut.Reset()
+	require.NoError(t, logger.SetLevel(logrus.DebugLevel.String()))
+	l.Debug("now shown", "id", 456)
+	assert.Empty(t, logrusOut.String())
+	assert.Contains(t, zerologOut.String(), `"message":"now shown"`)
+	assert.Contains(t, zerologOut.String(), `"service":"test"`)
+	assert.Contains(t, zerologOut.String(), `"req":{"id":456}`)
+}
+
+func TestConfigure(t *testing.T) {
+	t.Cleanup(func() {
+		log.Logger = zerolog.New(os.Stderr).With().Timestamp().Logger()
+		logger.UseZerolog(&log.Logger)
+		require.NoError(t, logger.SetLevel(logrus.InfoLevel.String()))
+	})
+
+	file := filepath.Join(t.TempDir(), "out.log")
+
+	require.NoError(t, logger.Configure(logger.LoggerOpts{
+		Level:      logrus.DebugLevel.String(),
+		Format:     logger.FormatAuto,
+		Output:     logger.OutputFile,
+		File:       file,
+		SampleRate: 0.5,
+	}))
+
+	for i := 0; i < 10; i++ {
+		logger.Default().Debug("sampled", "i", i)
+	}
+	logger.Default().Warn("always")
+	logger.Default().Warn("always")
+
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+
+	// Not a terminal, so it should be JSON
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Len(t, lines, 7)
+	assert.Contains(t, lines[0], `"message":"sampled"`)
+	assert.Contains(t, lines[0], `"level":"debug"`)
+	assert.Equal(t, 2, strings.Count(string(data), `"message":"always"`))
+}
+
+func TestConfigureErrors(t *testing.T) {
+	assert.Error(t, logger.Configure(logger.LoggerOpts{Output: logger.OutputFile}))
+	assert.Error(t, logger.Configure(logger.LoggerOpts{Output: "somewhere"}))
+	assert.Error(t, logger.Configure(logger.LoggerOpts{Format: "xml"}))
+	assert.Error(t, logger.Configure(logger.LoggerOpts{SampleRate: 2}))
+	assert.Error(t, logger.Configure(logger.LoggerOpts{Level: "loud"}))
+
+	// An invalid option mustn't leave the level half changed
+	require.NoError(t, logger.SetLevel(logrus.InfoLevel.String()))
+	assert.Error(t, logger.Configure(logger.LoggerOpts{Level: logrus.DebugLevel.String(), Format: "xml"}))
+	assert.Equal(t, logrus.InfoLevel, logger.Logger.GetLevel())
+}
+
+func TestNewCobraOptsSampleRate(t *testing.T) {
+	tests := []struct {
+		Name       string
+		Args       []string
+		SampleRate float64
+		Error      bool
+	}{
+		{
+			Name:       "default",
+			SampleRate: 1,
+		},
+		{
+			Name:       "half",
+			Args:       []string{"--log-sample-rate", "0.5"},
+			SampleRate: 0.5,
+		},
+		{
+			Name:  "zero",
+			Args:  []string{"--log-sample-rate", "0"},
+			Error: true,
+		},
+		{
+			Name:  "too high",
+			Args:  []string{"--log-sample-rate", "2"},
+			Error: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			var opts logger.LoggerOpts
+			cmd := &cobra.Command{RunE: func(*cobra.Command, []string) error { return nil }}
+			logger.NewCobraOpts(cmd, &opts)
+			cmd.SetArgs(test.Args)
+			cmd.SilenceErrors = true
+			cmd.SilenceUsage = true
+
+			err := cmd.Execute()
+			if test.Error {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.SampleRate, opts.SampleRate)
+		})
+	}
+}
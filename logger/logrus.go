@@ -0,0 +1,119 @@
+/*
+ * Copyright 2023 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// logrusHandler is a slog handler that writes to logrus. Groups are
+// flattened into dot-separated field names.
+type logrusHandler struct {
+	logger *logrus.Logger
+	level  slog.Leveler
+	fields logrus.Fields
+	groups []string
+}
+
+func newLogrusHandler(l *logrus.Logger, lvl slog.Leveler) *logrusHandler {
+	return &logrusHandler{
+		logger: l,
+		level:  lvl,
+		fields: logrus.Fields{},
+	}
+}
+
+func (h *logrusHandler) Enabled(_ context.Context, l slog.Level) bool {
+	return l >= h.level.Level()
+}
+
+func (h *logrusHandler) Handle(ctx context.Context, r slog.Record) error {
+	fields := make(logrus.Fields, len(h.fields)+r.NumAttrs())
+	for k, v := range h.fields {
+		fields[k] = v
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		addLogrusField(fields, h.groups, a)
+		return true
+	})
+
+	h.logger.
+		WithContext(ctx).
+		WithTime(r.Time).
+		WithFields(fields).
+		Log(toLogrusLevel(r.Level), r.Message)
+
+	return nil
+}
+
+func (h *logrusHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	fields := make(logrus.Fields, len(h.fields)+len(attrs))
+	for k, v := range h.fields {
+		fields[k] = v
+	}
+	for _, a := range attrs {
+		addLogrusField(fields, h.groups, a)
+	}
+
+	return &logrusHandler{
+		logger: h.logger,
+		level:  h.level,
+		fields: fields,
+		groups: h.groups,
+	}
+}
+
+func (h *logrusHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	groups := make([]string, 0, len(h.groups)+1)
+	groups = append(groups, h.groups...)
+
+	return &logrusHandler{
+		logger: h.logger,
+		level:  h.level,
+		fields: h.fields,
+		groups: append(groups, name),
+	}
+}
+
+func addLogrusField(fields logrus.Fields, groups []string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+
+	if a.Value.Kind() == slog.KindGroup {
+		g := groups
+		if a.Key != "" {
+			g = append(append([]string{}, groups...), a.Key)
+		}
+		for _, ga := range a.Value.Group() {
+			addLogrusField(fields, g, ga)
+		}
+		return
+	}
+
+	key := strings.Join(append(append([]string{}, groups...), a.Key), ".")
+	fields[key] = a.Value.Any()
+}
@@ -0,0 +1,362 @@
+/*
+ * Copyright 2023 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package logger
+
+import (
+	"encoding"
+	"encoding/json"
+	"log/slog"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Redacted replaces any sensitive value in the logs
+const Redacted = "***"
+
+// SensitiveTag is the struct tag that marks a field as sensitive, for example
+// `log:"sensitive"`. For protobuf messages, use the debug_redact field option.
+const SensitiveTag = "log"
+
+// Secrets shorter than this are ignored as they'd mask too much of the logs
+const minSecretLength = 4
+
+// Nested values deeper than this are logged as they are
+const maxRedactDepth = 16
+
+type redactor struct {
+	mu       sync.RWMutex
+	secrets  []string
+	fields   map[string]bool
+	patterns []*regexp.Regexp
+}
+
+var redact = &redactor{
+	fields: map[string]bool{},
+}
+
+func init() {
+	AddSensitiveFields("password", "token", "apiKey", "accessToken", "refreshToken")
+}
+
+// AddSecret registers values, such as an API key, that are masked wherever
+// they appear in a log message or string value
+func AddSecret(values ...string) {
+	redact.mu.Lock()
+	defer redact.mu.Unlock()
+
+	for _, v := range values {
+		if len(v) >= minSecretLength {
+			redact.secrets = append(redact.secrets, v)
+		}
+	}
+}
+
+// AddSensitiveFields registers field names whose values are always masked.
+// Names are matched ignoring case, underscores and dashes. They also match
+// the end of a name after a ".", "_" or "-", so "token" covers
+// "refresh_token" and "auth.token" but not "nextPageToken".
+func AddSensitiveFields(names ...string) {
+	redact.mu.Lock()
+	defer redact.mu.Unlock()
+
+	for _, n := range names {
+		redact.fields[normaliseField(n)] = true
+	}
+}
+
+// AddRedactPatterns registers patterns that are masked wherever they match a
+// log message or string value
+func AddRedactPatterns(patterns ...*regexp.Regexp) {
+	redact.mu.Lock()
+	defer redact.mu.Unlock()
+
+	redact.patterns = append(redact.patterns, patterns...)
+}
+
+// Redact returns a copy of the value with anything sensitive masked. Values
+// with nothing to mask are returned unchanged.
+func Redact(v any) any {
+	redact.mu.RLock()
+	defer redact.mu.RUnlock()
+
+	out, _ := redact.value(v, 0)
+	return out
+}
+
+func normaliseField(name string) string {
+	return strings.NewReplacer("_", "", "-", "").Replace(strings.ToLower(name))
+}
+
+func (r *redactor) isSensitiveField(name string) bool {
+	if r.fields[normaliseField(name)] {
+		return true
+	}
+
+	for i, c := range name {
+		if (c == '.' || c == '_' || c == '-') && r.fields[normaliseField(name[i+1:])] {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *redactor) string(s string) string {
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, Redacted)
+	}
+	for _, p := range r.patterns {
+		s = p.ReplaceAllString(s, Redacted)
+	}
+	return s
+}
+
+func (r *redactor) record(rec slog.Record) slog.Record {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	out := slog.NewRecord(rec.Time, rec.Level, r.string(rec.Message), rec.PC)
+	rec.Attrs(func(a slog.Attr) bool {
+		out.AddAttrs(r.attr(a))
+		return true
+	})
+	return out
+}
+
+func (r *redactor) attrs(attrs []slog.Attr) []slog.Attr {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	out := make([]slog.Attr, 0, len(attrs))
+	for _, a := range attrs {
+		out = append(out, r.attr(a))
+	}
+	return out
+}
+
+func (r *redactor) attr(a slog.Attr) slog.Attr {
+	v := a.Value.Resolve()
+
+	if v.Kind() == slog.KindGroup {
+		group := v.Group()
+		out := make([]slog.Attr, 0, len(group))
+		for _, ga := range group {
+			out = append(out, r.attr(ga))
+		}
+		return slog.Attr{Key: a.Key, Value: slog.GroupValue(out...)}
+	}
+
+	if r.isSensitiveField(a.Key) {
+		return slog.String(a.Key, Redacted)
+	}
+
+	switch v.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, r.string(v.String()))
+	case slog.KindAny:
+		if out, changed := r.value(v.Any(), 0); changed {
+			return slog.Any(a.Key, out)
+		}
+	default:
+	}
+
+	return slog.Attr{Key: a.Key, Value: v}
+}
+
+// value walks the value, returning a redacted copy and whether anything changed
+func (r *redactor) value(v any, depth int) (any, bool) {
+	if depth > maxRedactDepth {
+		return v, false
+	}
+
+	switch t := v.(type) {
+	case nil:
+		return nil, false
+	case string:
+		s := r.string(t)
+		return s, s != t
+	case proto.Message:
+		return r.proto(t, depth)
+	case error:
+		s := r.string(t.Error())
+		if s != t.Error() {
+			return s, true
+		}
+		return v, false
+	case json.Marshaler, encoding.TextMarshaler:
+		// These control their own output, such as time.Time
+		return v, false
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			return v, false
+		}
+		if out, changed := r.value(rv.Elem().Interface(), depth+1); changed {
+			return out, true
+		}
+		return v, false
+	case reflect.Struct:
+		return r.structValue(rv, depth)
+	case reflect.Map:
+		return r.mapValue(rv, depth)
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return v, false
+		}
+		out := make([]any, rv.Len())
+		changed := false
+		for i := range out {
+			var c bool
+			out[i], c = r.value(rv.Index(i).Interface(), depth+1)
+			changed = changed || c
+		}
+		if !changed {
+			return v, false
+		}
+		return out, true
+	default:
+		return v, false
+	}
+}
+
+func (r *redactor) structValue(rv reflect.Value, depth int) (any, bool) {
+	out := map[string]any{}
+	changed := false
+
+	for i := 0; i < rv.NumField(); i++ {
+		f := rv.Type().Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		name := f.Name
+		if tag, _, _ := strings.Cut(f.Tag.Get("json"), ","); tag == "-" {
+			continue
+		} else if tag != "" {
+			name = tag
+		}
+
+		if f.Tag.Get(SensitiveTag) == "sensitive" || r.isSensitiveField(name) {
+			out[name] = Redacted
+			changed = true
+			continue
+		}
+
+		var c bool
+		out[name], c = r.value(rv.Field(i).Interface(), depth+1)
+		changed = changed || c
+	}
+
+	if !changed {
+		return rv.Interface(), false
+	}
+	return out, true
+}
+
+func (r *redactor) mapValue(rv reflect.Value, depth int) (any, bool) {
+	if rv.Type().Key().Kind() != reflect.String {
+		return rv.Interface(), false
+	}
+
+	out := make(map[string]any, rv.Len())
+	changed := false
+
+	iter := rv.MapRange()
+	for iter.Next() {
+		k := iter.Key().String()
+		if r.isSensitiveField(k) {
+			out[k] = Redacted
+			changed = true
+			continue
+		}
+
+		var c bool
+		out[k], c = r.value(iter.Value().Interface(), depth+1)
+		changed = changed || c
+	}
+
+	if !changed {
+		return rv.Interface(), false
+	}
+	return out, true
+}
+
+// proto masks fields with the debug_redact option or a sensitive name, then
+// converts the message to a map so the rest of the values can be checked
+func (r *redactor) proto(msg proto.Message, depth int) (any, bool) {
+	clone := proto.Clone(msg)
+	changed := r.protoMessage(clone.ProtoReflect())
+
+	data, err := protojson.Marshal(clone)
+	if err != nil {
+		return msg, false
+	}
+	var m map[string]any
+	if err := json.Unmarshal(data, &m); err != nil {
+		return msg, false
+	}
+
+	out, c := r.mapValue(reflect.ValueOf(m), depth+1)
+	if !changed && !c {
+		return msg, false
+	}
+	return out, true
+}
+
+func (r *redactor) protoMessage(m protoreflect.Message) bool {
+	changed := false
+
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		opts, _ := fd.Options().(*descriptorpb.FieldOptions)
+		if opts.GetDebugRedact() || r.isSensitiveField(string(fd.Name())) {
+			if fd.Kind() == protoreflect.StringKind && !fd.IsList() && !fd.IsMap() {
+				m.Set(fd, protoreflect.ValueOfString(Redacted))
+			} else {
+				m.Clear(fd)
+			}
+			changed = true
+			return true
+		}
+
+		switch {
+		case fd.IsList() && fd.Message() != nil:
+			list := v.List()
+			for i := 0; i < list.Len(); i++ {
+				changed = r.protoMessage(list.Get(i).Message()) || changed
+			}
+		case fd.IsMap() && fd.MapValue().Message() != nil:
+			v.Map().Range(func(_ protoreflect.MapKey, mv protoreflect.Value) bool {
+				changed = r.protoMessage(mv.Message()) || changed
+				return true
+			})
+		case !fd.IsList() && !fd.IsMap() && fd.Message() != nil:
+			changed = r.protoMessage(v.Message()) || changed
+		}
+		return true
+	})
+
+	return changed
+}
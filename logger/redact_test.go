@@ -0,0 +1,162 @@
+/*
+ * Copyright 2023 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package logger_test
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+
+	"github.com/mrsimonemms/golang-helpers/logger"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+type credentials struct {
+	User     string `json:"user"`
+	Password string `json:"password"`
+	Pin      string `json:"pin" log:"sensitive"`
+}
+
+func TestRedact(t *testing.T) {
+	logger.AddSecret("super-secret-value")
+	logger.AddSensitiveFields("pin")
+	logger.AddRedactPatterns(regexp.MustCompile(`card-\d{4}`))
+
+	tests := []struct {
+		Name     string
+		Value    any
+		Expected any
+	}{
+		{
+			Name:     "unchanged string",
+			Value:    "hello world",
+			Expected: "hello world",
+		},
+		{
+			Name:     "secret",
+			Value:    "key is super-secret-value",
+			Expected: "key is ***",
+		},
+		{
+			Name:     "pattern",
+			Value:    "paid with card-1234",
+			Expected: "paid with ***",
+		},
+		{
+			Name:     "unchanged struct",
+			Value:    struct{ Name string }{Name: "bob"},
+			Expected: struct{ Name string }{Name: "bob"},
+		},
+		{
+			Name:  "struct",
+			Value: &credentials{User: "bob", Password: "pa55", Pin: "1234"},
+			Expected: map[string]any{
+				"user":     "bob",
+				"password": "***",
+				"pin":      "***",
+			},
+		},
+		{
+			Name: "map",
+			Value: map[string]any{
+				"accessToken": "abc",
+				"nested":      []any{"super-secret-value"},
+			},
+			Expected: map[string]any{
+				"accessToken": "***",
+				"nested":      []any{"***"},
+			},
+		},
+		{
+			Name: "field boundaries",
+			Value: map[string]any{
+				"refresh_token": "abc",
+				"auth.token":    "abc",
+				"db-api-key":    "abc",
+				"API_KEY":       "abc",
+				"nextPageToken": "page-2",
+				"pageToken":     "page-3",
+			},
+			Expected: map[string]any{
+				"refresh_token": "***",
+				"auth.token":    "***",
+				"db-api-key":    "***",
+				"API_KEY":       "***",
+				"nextPageToken": "page-2",
+				"pageToken":     "page-3",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			assert.Equal(t, test.Expected, logger.Redact(test.Value))
+		})
+	}
+}
+
+func TestRedactProto(t *testing.T) {
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("redact.proto"),
+		Package: proto.String("redact"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Message"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				{
+					Name:     proto.String("name"),
+					JsonName: proto.String("name"),
+					Number:   proto.Int32(1),
+					Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+				},
+				{
+					Name:     proto.String("card"),
+					JsonName: proto.String("card"),
+					Number:   proto.Int32(2),
+					Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+					Options:  &descriptorpb.FieldOptions{DebugRedact: proto.Bool(true)},
+				},
+			},
+		}},
+	}, nil)
+	require.NoError(t, err)
+
+	msg := dynamicpb.NewMessage(fd.Messages().Get(0))
+	msg.Set(fd.Messages().Get(0).Fields().ByName("name"), protoreflect.ValueOfString("bob"))
+	msg.Set(fd.Messages().Get(0).Fields().ByName("card"), protoreflect.ValueOfString("4111"))
+
+	var out bytes.Buffer
+	zl := zerolog.New(&out)
+	logger.UseZerolog(&zl)
+	t.Cleanup(func() {
+		logger.UseZerolog(&log.Logger)
+	})
+
+	logger.Default().Info("Response", "response", msg)
+
+	assert.Contains(t, out.String(), `"response":{"card":"***","name":"bob"}`)
+	// The original message is untouched
+	assert.Equal(t, "4111", msg.Get(fd.Messages().Get(0).Fields().ByName("card")).String())
+}
@@ -0,0 +1,68 @@
+/*
+ * Copyright 2023 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"sync/atomic"
+)
+
+// samplingHandler keeps a fixed fraction of the records below warning level.
+// It's deterministic, so a rate of 0.25 keeps exactly every fourth record.
+// Warnings and errors are always kept.
+type samplingHandler struct {
+	slog.Handler
+	rate  float64
+	count *atomic.Uint64
+}
+
+func newSamplingHandler(h slog.Handler, rate float64) *samplingHandler {
+	return &samplingHandler{
+		Handler: h,
+		rate:    rate,
+		count:   new(atomic.Uint64),
+	}
+}
+
+func (h *samplingHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level < slog.LevelWarn {
+		n := float64(h.count.Add(1))
+		// Keep the record each time the running total of the rate passes a whole number
+		if math.Floor(n*h.rate) == math.Floor((n-1)*h.rate) {
+			return nil
+		}
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *samplingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &samplingHandler{
+		Handler: h.Handler.WithAttrs(attrs),
+		rate:    h.rate,
+		count:   h.count,
+	}
+}
+
+func (h *samplingHandler) WithGroup(name string) slog.Handler {
+	return &samplingHandler{
+		Handler: h.Handler.WithGroup(name),
+		rate:    h.rate,
+		count:   h.count,
+	}
+}
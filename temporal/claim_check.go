@@ -0,0 +1,309 @@
+/*
+ * Copyright 2023 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package temporal
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+
+	commonpb "go.temporal.io/api/common/v1"
+	"go.temporal.io/sdk/converter"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// MetadataEncodingClaimCheck is the encoding of payloads moved to a blob store
+	MetadataEncodingClaimCheck = "binary/claim-check"
+	// MetadataClaimCheckSize is the size of the payload in the blob store
+	MetadataClaimCheckSize = "claim-check-size"
+)
+
+// ErrBlobNotFound is returned by a BlobStore when the key doesn't exist
+var ErrBlobNotFound = errors.New("blob not found")
+
+// BlobStore stores payloads for the claim check codec. Keys are the SHA-256
+// hash of the unencoded payload, so the same payload is only stored once.
+type BlobStore interface {
+	Put(ctx context.Context, key string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+}
+
+type ClaimCheckOption func(*ClaimCheckCodec)
+
+// ClaimCheckCodec moves payloads larger than the threshold to a blob store
+// and replaces them with a reference to it
+type ClaimCheckCodec struct {
+	store      BlobStore
+	threshold  int
+	blobCodecs []converter.PayloadCodec
+}
+
+// Deterministic so the same payload always has the same key
+var claimCheckMarshal = proto.MarshalOptions{Deterministic: true}
+
+// WithClaimCheckThreshold sets the size in bytes above which payloads are
+// moved to the blob store. Defaults to 256KiB.
+func WithClaimCheckThreshold(threshold int) ClaimCheckOption {
+	return func(c *ClaimCheckCodec) {
+		c.threshold = threshold
+	}
+}
+
+// WithClaimCheckBlobCodecs encodes the payloads in the blob store with the
+// codecs, such as encryption. They're applied in the same order as
+// NewCodecDataConverter, so the first codec is the last to encode.
+func WithClaimCheckBlobCodecs(codecs ...converter.PayloadCodec) ClaimCheckOption {
+	return func(c *ClaimCheckCodec) {
+		c.blobCodecs = codecs
+	}
+}
+
+// NewClaimCheckCodec creates the codec. Chain it with other codecs with
+// NewCodecDataConverter - put it last, so it sees the unencoded payloads and
+// identical payloads share a blob. Encryption uses a random nonce, so an
+// encrypted payload never matches another. To keep the blobs encrypted, pass
+// the encryption codec to WithClaimCheckBlobCodecs too.
+func NewClaimCheckCodec(store BlobStore, opts ...ClaimCheckOption) *ClaimCheckCodec {
+	c := &ClaimCheckCodec{
+		store:     store,
+		threshold: 256 * 1024,
+	}
+	for _, o := range opts {
+		o(c)
+	}
+	return c
+}
+
+// Encode moves each payload above the threshold to the blob store
+func (c *ClaimCheckCodec) Encode(payloads []*commonpb.Payload) ([]*commonpb.Payload, error) {
+	result := make([]*commonpb.Payload, len(payloads))
+	for i, p := range payloads {
+		data, err := claimCheckMarshal.Marshal(p)
+		if err != nil {
+			return nil, fmt.Errorf("error marshalling payload: %w", err)
+		}
+
+		if len(data) <= c.threshold {
+			result[i] = p
+			continue
+		}
+
+		hash := sha256.Sum256(data)
+		key := hex.EncodeToString(hash[:])
+
+		blob, err := c.encodeBlob(p)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := c.store.Put(context.Background(), key, blob); err != nil {
+			return nil, fmt.Errorf("error storing payload %s: %w", key, err)
+		}
+
+		result[i] = &commonpb.Payload{
+			Metadata: map[string][]byte{
+				converter.MetadataEncoding: []byte(MetadataEncodingClaimCheck),
+				MetadataClaimCheckSize:     []byte(strconv.Itoa(len(data))),
+			},
+			Data: []byte(key),
+		}
+	}
+
+	return result, nil
+}
+
+// Decode fetches each referenced payload from the blob store. Other payloads
+// are returned unchanged.
+func (c *ClaimCheckCodec) Decode(payloads []*commonpb.Payload) ([]*commonpb.Payload, error) {
+	result := make([]*commonpb.Payload, len(payloads))
+	for i, p := range payloads {
+		if string(p.GetMetadata()[converter.MetadataEncoding]) != MetadataEncodingClaimCheck {
+			result[i] = p
+			continue
+		}
+
+		key := string(p.GetData())
+		blob, err := c.store.Get(context.Background(), key)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching payload %s: %w", key, err)
+		}
+
+		payload, err := c.decodeBlob(blob)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding payload %s: %w", key, err)
+		}
+
+		// Catch anything changed or corrupted in the store
+		data, err := claimCheckMarshal.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("error marshalling payload: %w", err)
+		}
+		if hash := sha256.Sum256(data); hex.EncodeToString(hash[:]) != key {
+			return nil, fmt.Errorf("payload %s does not match its hash", key)
+		}
+
+		result[i] = payload
+	}
+
+	return result, nil
+}
+
+func (c *ClaimCheckCodec) encodeBlob(p *commonpb.Payload) ([]byte, error) {
+	payloads := []*commonpb.Payload{p}
+	for i := len(c.blobCodecs) - 1; i >= 0; i-- {
+		var err error
+		if payloads, err = c.blobCodecs[i].Encode(payloads); err != nil {
+			return nil, fmt.Errorf("error encoding blob: %w", err)
+		}
+	}
+
+	data, err := proto.Marshal(payloads[0])
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling blob: %w", err)
+	}
+	return data, nil
+}
+
+func (c *ClaimCheckCodec) decodeBlob(blob []byte) (*commonpb.Payload, error) {
+	p := &commonpb.Payload{}
+	if err := proto.Unmarshal(blob, p); err != nil {
+		return nil, fmt.Errorf("error unmarshalling blob: %w", err)
+	}
+
+	payloads := []*commonpb.Payload{p}
+	for _, codec := range c.blobCodecs {
+		var err error
+		if payloads, err = codec.Decode(payloads); err != nil {
+			return nil, fmt.Errorf("error decoding blob: %w", err)
+		}
+	}
+	return payloads[0], nil
+}
+
+// MemoryBlobStore keeps payloads in memory. It's only suitable for tests and
+// single process deployments.
+type MemoryBlobStore struct {
+	mu    sync.RWMutex
+	blobs map[string][]byte
+}
+
+func NewMemoryBlobStore() *MemoryBlobStore {
+	return &MemoryBlobStore{
+		blobs: map[string][]byte{},
+	}
+}
+
+func (m *MemoryBlobStore) Put(_ context.Context, key string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.blobs[key]; !ok {
+		m.blobs[key] = append([]byte(nil), data...)
+	}
+	return nil
+}
+
+func (m *MemoryBlobStore) Get(_ context.Context, key string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	data, ok := m.blobs[key]
+	if !ok {
+		return nil, ErrBlobNotFound
+	}
+	return append([]byte(nil), data...), nil
+}
+
+// blobKey stops keys escaping the directory
+var blobKey = regexp.MustCompile(`^[a-f0-9]{64}$`)
+
+// FileBlobStore keeps payloads as files in a directory, such as a shared
+// volume mounted on every worker
+type FileBlobStore struct {
+	dir string
+}
+
+func NewFileBlobStore(dir string) (*FileBlobStore, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("error creating blob store directory: %w", err)
+	}
+	return &FileBlobStore{dir: dir}, nil
+}
+
+func (f *FileBlobStore) path(key string) (string, error) {
+	if !blobKey.MatchString(key) {
+		return "", fmt.Errorf("invalid blob key: %s", key)
+	}
+	return filepath.Join(f.dir, key), nil
+}
+
+func (f *FileBlobStore) Put(_ context.Context, key string, data []byte) error {
+	path, err := f.path(key)
+	if err != nil {
+		return err
+	}
+
+	// The key is the content hash, so an existing file is the same payload
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	// Write to a temporary file first, so a partial file is never read
+	tmp, err := os.CreateTemp(f.dir, key+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("error creating blob file: %w", err)
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("error writing blob file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing blob file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("error saving blob file: %w", err)
+	}
+	return nil
+}
+
+func (f *FileBlobStore) Get(_ context.Context, key string) ([]byte, error) {
+	path, err := f.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrBlobNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading blob file: %w", err)
+	}
+	return data, nil
+}
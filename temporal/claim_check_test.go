@@ -0,0 +1,137 @@
+/*
+ * Copyright 2023 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package temporal
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	commonpb "go.temporal.io/api/common/v1"
+)
+
+func TestClaimCheckCodec(t *testing.T) {
+	fileStore, err := NewFileBlobStore(t.TempDir())
+	require.NoError(t, err)
+
+	stores := map[string]BlobStore{
+		"memory": NewMemoryBlobStore(),
+		"file":   fileStore,
+	}
+
+	large := strings.Repeat("x", 1024)
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			dc := NewCodecDataConverter(NewClaimCheckCodec(store, WithClaimCheckThreshold(512)))
+
+			payload, err := dc.ToPayload(large)
+			require.NoError(t, err)
+			assert.Equal(t, MetadataEncodingClaimCheck, string(payload.Metadata["encoding"]))
+			assert.Len(t, payload.Data, 64)
+
+			// The same content has the same key
+			again, err := dc.ToPayload(large)
+			require.NoError(t, err)
+			assert.Equal(t, payload.Data, again.Data)
+
+			var value string
+			require.NoError(t, dc.FromPayload(payload, &value))
+			assert.Equal(t, large, value)
+
+			small, err := dc.ToPayload("small")
+			require.NoError(t, err)
+			assert.NotEqual(t, MetadataEncodingClaimCheck, string(small.Metadata["encoding"]))
+
+			// Unknown keys fail to decode
+			payload.Data = []byte(strings.Repeat("0", 64))
+			assert.Error(t, dc.FromPayload(payload, &value))
+		})
+	}
+}
+
+func TestClaimCheckCodecWithEncryption(t *testing.T) {
+	encryption, err := NewEncryptionCodec(EncryptionKey{ID: "key", Key: bytes.Repeat([]byte{1}, 32)})
+	require.NoError(t, err)
+
+	store := NewMemoryBlobStore()
+	dc := NewCodecDataConverter(
+		encryption,
+		NewClaimCheckCodec(store, WithClaimCheckThreshold(512), WithClaimCheckBlobCodecs(encryption)),
+	)
+
+	large := strings.Repeat("x", 1024)
+
+	first, err := dc.ToPayload(large)
+	require.NoError(t, err)
+	second, err := dc.ToPayload(large)
+	require.NoError(t, err)
+
+	// The references are encrypted, but share one blob
+	assert.Equal(t, MetadataEncodingEncrypted, string(first.Metadata["encoding"]))
+	assert.NotEqual(t, first.Data, second.Data)
+	require.Len(t, store.blobs, 1)
+
+	for _, blob := range store.blobs {
+		assert.NotContains(t, string(blob), large)
+	}
+
+	for _, p := range []*commonpb.Payload{first, second} {
+		var value string
+		require.NoError(t, dc.FromPayload(p, &value))
+		assert.Equal(t, large, value)
+	}
+}
+
+func TestMemoryBlobStoreCopies(t *testing.T) {
+	store := NewMemoryBlobStore()
+	key := strings.Repeat("a", 64)
+	require.NoError(t, store.Put(context.Background(), key, []byte("data")))
+
+	data, err := store.Get(context.Background(), key)
+	require.NoError(t, err)
+	data[0] = 'x'
+
+	data, err = store.Get(context.Background(), key)
+	require.NoError(t, err)
+	assert.Equal(t, "data", string(data))
+}
+
+func TestFileBlobStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileBlobStore(dir)
+	require.NoError(t, err)
+
+	assert.Error(t, store.Put(context.Background(), "../escape", []byte("data")))
+	_, err = store.Get(context.Background(), "../escape")
+	assert.Error(t, err)
+
+	key := strings.Repeat("a", 64)
+	require.NoError(t, store.Put(context.Background(), key, []byte("data")))
+	require.NoError(t, store.Put(context.Background(), key, []byte("data")))
+
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, files, 1)
+
+	_, err = store.Get(context.Background(), strings.Repeat("b", 64))
+	assert.ErrorIs(t, err, ErrBlobNotFound)
+}
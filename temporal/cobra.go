@@ -24,10 +24,22 @@ cmd := &cobra.Command{
 	Use:   "run",
 	Short: "Run a Temporal worker",
 	RunE: func(cmd *cobra.Command, args []string) error {
+		// Read the values from the flags, envvars and config file
+		connOpts := temporal.ParseCobraOpts(opts.temporal)
+
+		metrics, metricsCloser, err := temporal.WithPrometheusMetrics(opts.temporal.MetricsListenAddress, opts.temporal.MetricsPrefix, nil)
+		if err != nil {
+			return gh.FatalError{
+				Cause: err,
+				Msg:   "Unable to start metrics",
+			}
+		}
+		defer metricsCloser.Close()
+
 		c, err := temporal.NewConnection(append(
-			temporal.ParseCobraOpts(opts.temporal),
+			connOpts,
 			temporal.WithZerolog(&log.Logger),
-			temporal.WithPrometheusMetrics(opts.temporal.MetricsListenAddress, opts.temporal.MetricsPrefix, nil),
+			metrics,
 		)...)
 		if err != nil {
 			return gh.FatalError{
@@ -40,7 +52,15 @@ cmd := &cobra.Command{
 		w := worker.New(c, TaskQueue, worker.Options{})
 
 		// Start the healthcheck server in a separate goroutine
-		temporal.NewHealthCheck(cmd.Context(), []string{TaskQueue}, opts.temporal.HealthListenAddress, c)
+		if _, err := temporal.NewHealthCheck(
+			cmd.Context(), []string{TaskQueue}, opts.temporal.HealthListenAddress, c,
+			temporal.WithHealthNamespace(opts.temporal.Namespace),
+		); err != nil {
+			return gh.FatalError{
+				Cause: err,
+				Msg:   "Unable to start health check server",
+			}
+		}
 
 		if err := w.Run(worker.InterruptCh()); err != nil {
 			return gh.FatalError{
@@ -52,99 +72,448 @@ cmd := &cobra.Command{
 		return nil
 	},
 }
+
+opts.temporal = temporal.NewCobraOpts(cmd, &temporal.TemporalOpts{}, temporal.WithCobraViper(v), temporal.WithCobraEnvPrefix("myapp"))
 */
 
 import (
-	gh "github.com/mrsimonemms/golang-helpers"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"strings"
+
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/contrib/envconfig"
 )
 
 type TemporalOpts struct {
 	Address              string
+	AddressResolver      string
 	APIKey               string
+	APIKeyFile           string
+	ConfigFile           string
+	Headers              map[string]string
 	HealthListenAddress  string
+	Identity             string
 	MetricsListenAddress string
 	MetricsPrefix        string
 	MTLSCertPath         string
 	MTLSKeyPath          string
 	Namespace            string
+	Profile              string
 	ServerName           string
 	TLSEnabled           bool
+
+	// Set by NewCobraOpts to read the values when the command runs
+	flags flagBindings
+
+	// The envconfig profile, if one's used
+	profile     *envconfig.ClientConfigProfile
+	profileAuth bool
+}
+
+type cobraConfig struct {
+	viper     *viper.Viper
+	envPrefix string
+}
+
+type CobraOption func(*cobraConfig)
+
+// WithCobraViper resolves the flags with this viper instance. Defaults to
+// the global instance.
+func WithCobraViper(v *viper.Viper) CobraOption {
+	return func(c *cobraConfig) {
+		c.viper = v
+	}
+}
+
+// WithCobraEnvPrefix sets the prefix of the environment variables, so
+// "myapp" reads MYAPP_TEMPORAL_ADDRESS rather than TEMPORAL_ADDRESS
+func WithCobraEnvPrefix(prefix string) CobraOption {
+	return func(c *cobraConfig) {
+		c.envPrefix = prefix
+	}
+}
+
+func newCobraConfig(cobraOpts []CobraOption) *cobraConfig {
+	cfg := &cobraConfig{
+		viper: viper.GetViper(),
+	}
+	for _, o := range cobraOpts {
+		o(cfg)
+	}
+	return cfg
+}
+
+func (c *cobraConfig) envName(key string) string {
+	if c.envPrefix == "" {
+		return strings.ToUpper(key)
+	}
+	return strings.ToUpper(c.envPrefix + "_" + key)
 }
 
-func NewCobraOpts(cmd *cobra.Command, opts *TemporalOpts) *TemporalOpts {
-	viper.SetDefault("health_listen_address", "0.0.0.0:3000")
+// flagBindings reads the flags when the command runs, after any config
+// files have been loaded. Flags aren't bound into viper, as viper holds one
+// flag per key and commands sharing an instance would overwrite each other.
+type flagBindings struct {
+	bindings []flagBinding
+	set      map[string]bool
+
+	// The flags are only read once, so a second Resolve doesn't read an
+	// envvar again and append it to a slice
+	resolved   bool
+	resolveErr error
+}
+
+type flagBinding struct {
+	key     string
+	resolve func() (bool, error)
+}
+
+// bindFlag reads the flag from the command line, then the envvar, then the
+// viper key, leaving the flag's default if none are set. An empty envvar
+// clears the value.
+func bindFlag[T any](c *cobraConfig, cmd *cobra.Command, b *flagBindings, p *T, key, flag string, get func(string) T) {
+	f := cmd.Flags().Lookup(flag)
+	env := c.envName(key)
+	v := c.viper
+
+	b.bindings = append(b.bindings, flagBinding{
+		key: key,
+		resolve: func() (bool, error) {
+			if f.Changed {
+				return true, nil
+			}
+			if value, ok := os.LookupEnv(env); ok {
+				if value == "" {
+					var zero T
+					*p = zero
+					return true, nil
+				}
+				if err := f.Value.Set(value); err != nil {
+					return false, fmt.Errorf("error parsing %s: %w", env, err)
+				}
+				return true, nil
+			}
+			if v.IsSet(key) {
+				*p = get(key)
+				return true, nil
+			}
+			return false, nil
+		},
+	})
+}
+
+func (b *flagBindings) resolve() error {
+	if b.resolved {
+		return b.resolveErr
+	}
+	b.resolved = true
+	b.set = map[string]bool{}
+
+	var errs []error
+	for _, binding := range b.bindings {
+		set, err := binding.resolve()
+		if err != nil {
+			errs = append(errs, err)
+		}
+		b.set[binding.key] = set
+	}
+
+	b.resolveErr = errors.Join(errs...)
+	return b.resolveErr
+}
+
+// explicit reports whether the value was set by a flag, envvar or viper,
+// rather than left as the default. Without bindings, any value counts.
+func (b *flagBindings) explicit(key string, nonZero bool) bool {
+	if len(b.bindings) == 0 {
+		return nonZero
+	}
+	return b.set[key]
+}
+
+// NewCobraOpts adds the Temporal connection flags to the command. Each flag
+// can also be set by an envvar or viper, and the values are resolved by
+// ParseCobraOpts, so config loaded in PersistentPreRunE is respected.
+func NewCobraOpts(cmd *cobra.Command, opts *TemporalOpts, cobraOpts ...CobraOption) *TemporalOpts {
+	cfg := newCobraConfig(cobraOpts)
+
+	bindString := func(p *string, key, flag string) {
+		bindFlag(cfg, cmd, &opts.flags, p, key, flag, cfg.viper.GetString)
+	}
+
 	cmd.Flags().StringVar(
 		&opts.HealthListenAddress, "health-listen-address",
-		viper.GetString("health_listen_address"), "Address of health server",
+		"0.0.0.0:3000", "Address of health server",
 	)
+	bindString(&opts.HealthListenAddress, "health_listen_address", "health-listen-address")
 
-	viper.SetDefault("metrics_listen_address", "0.0.0.0:9090")
 	cmd.Flags().StringVar(
 		&opts.MetricsListenAddress, "metrics-listen-address",
-		viper.GetString("metrics_listen_address"), "Address of Prometheus metrics server",
+		"0.0.0.0:9090", "Address of Prometheus metrics server",
 	)
+	bindString(&opts.MetricsListenAddress, "metrics_listen_address", "metrics-listen-address")
 
 	cmd.Flags().StringVar(
 		&opts.MetricsPrefix, "metrics-prefix",
-		viper.GetString("metrics_prefix"), "Prefix for metrics",
+		"", "Prefix for metrics",
 	)
+	bindString(&opts.MetricsPrefix, "metrics_prefix", "metrics-prefix")
 
-	viper.SetDefault("temporal_address", client.DefaultHostPort)
 	cmd.Flags().StringVarP(
 		&opts.Address, "temporal-address", "H",
-		viper.GetString("temporal_address"), "Address of the Temporal server",
+		client.DefaultHostPort, "Address of the Temporal server",
+	)
+	bindString(&opts.Address, "temporal_address", "temporal-address")
+
+	cmd.Flags().StringVar(
+		&opts.AddressResolver, "temporal-address-resolver",
+		"", "Resolve the Temporal endpoints from a srv://record or file:///path with one per line, re-resolved every 30s. "+
+			"Overrides --temporal-address. Set --temporal-server-name when using TLS",
 	)
+	bindString(&opts.AddressResolver, "temporal_address_resolver", "temporal-address-resolver")
 
 	cmd.Flags().StringVar(
 		&opts.APIKey, "temporal-api-key",
-		viper.GetString("temporal_api_key"), "API key for Temporal authentication",
+		"", "API key for Temporal authentication. Can be an env://VAR or file:///path reference",
 	)
-	// Hide the default value to avoid spaffing the API to command line
-	gh.HideCommandOutput(cmd, "temporal-api-key")
+	bindString(&opts.APIKey, "temporal_api_key", "temporal-api-key")
+
+	cmd.Flags().StringVar(
+		&opts.APIKeyFile, "temporal-api-key-file",
+		"", "Path to file containing the API key, re-read when it changes",
+	)
+	bindString(&opts.APIKeyFile, "temporal_api_key_file", "temporal-api-key-file")
 
 	cmd.Flags().StringVar(
 		&opts.MTLSCertPath, "tls-client-cert-path",
-		viper.GetString("temporal_tls_client_cert_path"), "Path to mTLS client cert, usually ending in .pem",
+		"", "Path to mTLS client cert, usually ending in .pem",
 	)
+	bindString(&opts.MTLSCertPath, "temporal_tls_client_cert_path", "tls-client-cert-path")
 
 	cmd.Flags().StringVar(
 		&opts.MTLSKeyPath, "tls-client-key-path",
-		viper.GetString("temporal_tls_client_key_path"), "Path to mTLS client key, usually ending in .key",
+		"", "Path to mTLS client key, usually ending in .key",
+	)
+	bindString(&opts.MTLSKeyPath, "temporal_tls_client_key_path", "tls-client-key-path")
+
+	cmd.Flags().StringToStringVar(
+		&opts.Headers, "temporal-header",
+		nil, "gRPC metadata to send with every Temporal request, as key=value",
 	)
+	bindFlag(cfg, cmd, &opts.flags, &opts.Headers, "temporal_header", "temporal-header", cfg.viper.GetStringMapString)
+
+	cmd.Flags().StringVar(
+		&opts.Identity, "temporal-identity",
+		"", "Identity of the Temporal client. Defaults to the pid, hostname and build version",
+	)
+	bindString(&opts.Identity, "temporal_identity", "temporal-identity")
+
+	cmd.Flags().StringVar(
+		&opts.ConfigFile, "temporal-config-file",
+		"", "Path to the Temporal TOML config file. Defaults to the envconfig default if a profile is set",
+	)
+	bindString(&opts.ConfigFile, "temporal_config_file", "temporal-config-file")
+
+	cmd.Flags().StringVar(
+		&opts.Profile, "temporal-profile",
+		"", "Profile in the Temporal config file to use. Flags that are set override the profile",
+	)
+	bindString(&opts.Profile, "temporal_profile", "temporal-profile")
 
-	viper.SetDefault("temporal_namespace", client.DefaultNamespace)
 	cmd.Flags().StringVarP(
 		&opts.Namespace, "temporal-namespace", "n",
-		viper.GetString("temporal_namespace"), "Temporal namespace to use",
+		client.DefaultNamespace, "Temporal namespace to use",
 	)
+	bindString(&opts.Namespace, "temporal_namespace", "temporal-namespace")
 
 	cmd.Flags().StringVar(
 		&opts.ServerName, "temporal-server-name",
-		viper.GetString("temporal_server_name"),
+		"",
 		"Override the TLS server name (SNI) used for certificate validation. "+
 			"Required when the endpoint address does not match the certificate hostname, for example AWS PrivateLink.",
 	)
+	bindString(&opts.ServerName, "temporal_server_name", "temporal-server-name")
 
 	cmd.Flags().BoolVar(
 		&opts.TLSEnabled, "temporal-tls",
-		viper.GetBool("temporal_tls"), "Enable TLS Temporal connection",
+		false, "Enable TLS Temporal connection",
 	)
+	bindFlag(cfg, cmd, &opts.flags, &opts.TLSEnabled, "temporal_tls", "temporal-tls", cfg.viper.GetBool)
 
 	return opts
 }
 
+// Resolve reads the flag values from the command line, envvars and viper,
+// and validates them. This is done by ParseCobraOpts, but can be called
+// earlier to use the values elsewhere. The flags are only read the first
+// time.
+func (o *TemporalOpts) Resolve() error {
+	if err := o.flags.resolve(); err != nil {
+		return err
+	}
+
+	if err := o.applyProfile(); err != nil {
+		return err
+	}
+
+	return o.Validate()
+}
+
+// applyProfile fills in anything that's not set explicitly from the
+// envconfig profile, so the flags are layered on top of it
+func (o *TemporalOpts) applyProfile() error {
+	if o.ConfigFile == "" && o.Profile == "" {
+		return nil
+	}
+
+	prof, err := envconfig.LoadClientConfigProfile(envconfig.LoadClientConfigProfileOptions{
+		ConfigFilePath:    o.ConfigFile,
+		ConfigFileProfile: o.Profile,
+	})
+	if err != nil {
+		return fmt.Errorf("error loading temporal profile: %w", err)
+	}
+	o.profile = &prof
+
+	setString := func(p *string, key, value string) {
+		if value != "" && !o.flags.explicit(key, *p != "") {
+			*p = value
+		}
+	}
+
+	setString(&o.Address, "temporal_address", prof.Address)
+	setString(&o.Namespace, "temporal_namespace", prof.Namespace)
+
+	// Credentials are taken as a whole, so a flag isn't mixed with the profile
+	o.profileAuth = !o.flags.explicit("temporal_api_key", o.APIKey != "") &&
+		!o.flags.explicit("temporal_api_key_file", o.APIKeyFile != "") &&
+		!o.flags.explicit("temporal_tls_client_cert_path", o.MTLSCertPath != "") &&
+		!o.flags.explicit("temporal_tls_client_key_path", o.MTLSKeyPath != "")
+	if o.profileAuth {
+		o.APIKey = prof.APIKey
+		if prof.TLS != nil {
+			o.MTLSCertPath = prof.TLS.ClientCertPath
+			o.MTLSKeyPath = prof.TLS.ClientKeyPath
+		}
+	}
+
+	if prof.TLS != nil {
+		setString(&o.ServerName, "temporal_server_name", prof.TLS.ServerName)
+	}
+
+	if !o.flags.explicit("temporal_tls", o.TLSEnabled) {
+		// As envconfig, an API key enables TLS unless the profile disables it
+		o.TLSEnabled = (prof.TLS != nil && !prof.TLS.Disabled) || (prof.TLS == nil && prof.APIKey != "")
+	}
+
+	return nil
+}
+
+// profileOptions are the settings in the profile that don't have a flag
+func (o *TemporalOpts) profileOptions() []Options {
+	prof := o.profile
+	if prof == nil {
+		return nil
+	}
+
+	var tlsOpts []TLSOptions
+	if prof.TLS != nil {
+		if prof.TLS.ServerCACertPath != "" {
+			tlsOpts = append(tlsOpts, WithTLSCAFile(prof.TLS.ServerCACertPath))
+		}
+		if len(prof.TLS.ServerCACertData) > 0 {
+			tlsOpts = append(tlsOpts, WithTLSCAPEM(prof.TLS.ServerCACertData))
+		}
+		if o.profileAuth && (len(prof.TLS.ClientCertData) > 0 || len(prof.TLS.ClientKeyData) > 0) {
+			tlsOpts = append(tlsOpts, WithTLSClientCertPEM(prof.TLS.ClientCertData, prof.TLS.ClientKeyData))
+		}
+		if prof.TLS.DisableHostVerification {
+			tlsOpts = append(tlsOpts, WithTLSInsecureSkipVerify(true))
+		}
+	}
+
+	// Headers from the flags replace those in the profile
+	meta := maps.Clone(prof.GRPCMeta)
+	for k := range o.Headers {
+		delete(meta, k)
+	}
+
+	return []Options{
+		WithTLS(o.TLSEnabled, tlsOpts...),
+		WithGRPCMetadata(meta),
+	}
+}
+
+// Validate checks the options don't contradict each other
+func (o *TemporalOpts) Validate() error {
+	var errs []error
+
+	if (o.MTLSCertPath == "") != (o.MTLSKeyPath == "") {
+		errs = append(errs, errors.New("tls-client-cert-path and tls-client-key-path must both be set"))
+	}
+
+	if o.APIKey != "" && o.APIKeyFile != "" {
+		errs = append(errs, errors.New("temporal-api-key and temporal-api-key-file cannot both be set"))
+	}
+
+	if (o.APIKey != "" || o.APIKeyFile != "") && (o.MTLSCertPath != "" || o.MTLSKeyPath != "") {
+		errs = append(errs, errors.New("api key and mtls cannot both be set"))
+	}
+
+	if o.AddressResolver != "" {
+		if _, err := ParseHostPortResolver(o.AddressResolver); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// ParseCobraOpts resolves the options and converts them to connection
+// options, starting from the envconfig profile if one is set. If they're
+// invalid, the first option returns the error so the
+// connection fails before dialling.
 func ParseCobraOpts(opts *TemporalOpts, overrides ...Options) []Options {
-	return append([]Options{
+	if err := opts.Resolve(); err != nil {
+		return []Options{
+			func(*client.Options) error {
+				return fmt.Errorf("error parsing temporal options: %w", err)
+			},
+		}
+	}
+
+	apiKey := opts.APIKey
+	if opts.APIKeyFile != "" {
+		apiKey = SecretFilePrefix + opts.APIKeyFile
+	}
+
+	connOpts := []Options{
 		WithHostPort(opts.Address),
 		WithNamespace(opts.Namespace),
+		WithIdentity(opts.Identity),
+		WithHeaders(opts.Headers),
 		WithTLS(opts.TLSEnabled, WithTLSServerName(opts.ServerName)),
-		WithAuthDetection(
-			opts.APIKey,
-			opts.MTLSCertPath,
-			opts.MTLSKeyPath,
-		),
-	}, overrides...)
+	}
+	if opts.AddressResolver != "" {
+		connOpts = append(connOpts, func(o *client.Options) error {
+			r, err := ParseHostPortResolver(opts.AddressResolver)
+			if err != nil {
+				return err
+			}
+			return WithHostPortResolver(r)(o)
+		})
+	}
+	connOpts = append(connOpts, opts.profileOptions()...)
+	connOpts = append(connOpts, WithAuthDetection(
+		apiKey,
+		opts.MTLSCertPath,
+		opts.MTLSKeyPath,
+	))
+
+	return append(connOpts, overrides...)
 }
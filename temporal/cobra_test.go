@@ -0,0 +1,224 @@
+/*
+ * Copyright 2023 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package temporal
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewCobraOptsLateBinding(t *testing.T) {
+	v := viper.New()
+	cmd := &cobra.Command{}
+	opts := NewCobraOpts(cmd, &TemporalOpts{}, WithCobraViper(v), WithCobraEnvPrefix("test"))
+
+	// Set after the command is built, as a config file would be
+	t.Setenv("TEST_TEMPORAL_NAMESPACE", "from-env")
+	v.Set("temporal_server_name", "from-config")
+	require.NoError(t, cmd.Flags().Parse([]string{
+		"--temporal-tls",
+		"-H", "temporal:7233",
+		"--temporal-header", "tenant=acme",
+		"--temporal-identity", "worker-1",
+	}))
+
+	require.NoError(t, opts.Resolve())
+	assert.Equal(t, "temporal:7233", opts.Address)
+	assert.Equal(t, "from-env", opts.Namespace)
+	assert.Equal(t, "from-config", opts.ServerName)
+	assert.True(t, opts.TLSEnabled)
+	assert.Equal(t, "0.0.0.0:3000", opts.HealthListenAddress)
+	assert.Equal(t, map[string]string{"tenant": "acme"}, opts.Headers)
+	assert.Equal(t, "worker-1", opts.Identity)
+}
+
+func TestNewCobraOptsSiblingCommands(t *testing.T) {
+	v := viper.New()
+
+	worker := &cobra.Command{Use: "worker"}
+	workerOpts := NewCobraOpts(worker, &TemporalOpts{}, WithCobraViper(v))
+
+	starter := &cobra.Command{Use: "starter"}
+	starterOpts := NewCobraOpts(starter, &TemporalOpts{}, WithCobraViper(v))
+
+	require.NoError(t, worker.Flags().Parse([]string{"-H", "worker:7233", "-n", "worker"}))
+	require.NoError(t, starter.Flags().Parse([]string{"-H", "starter:7233"}))
+
+	require.NoError(t, workerOpts.Resolve())
+	require.NoError(t, starterOpts.Resolve())
+
+	assert.Equal(t, "worker:7233", workerOpts.Address)
+	assert.Equal(t, "worker", workerOpts.Namespace)
+	assert.Equal(t, "starter:7233", starterOpts.Address)
+	assert.Equal(t, "default", starterOpts.Namespace)
+}
+
+func TestNewCobraOptsResolveOnce(t *testing.T) {
+	t.Setenv("CODEC_CORS_ORIGIN", "https://a")
+	t.Setenv("TEMPORAL_NAMESPACE", "")
+
+	v := viper.New()
+	v.Set("temporal_namespace", "from-viper")
+
+	cmd := &cobra.Command{Use: "worker"}
+	opts := NewCobraOpts(cmd, &TemporalOpts{}, WithCobraViper(v))
+	codecOpts := NewCodecServerCobraOpts(cmd, &CodecServerOpts{}, WithCobraViper(v))
+	require.NoError(t, cmd.Flags().Parse(nil))
+
+	for range 2 {
+		require.NoError(t, opts.Resolve())
+		require.NoError(t, codecOpts.Resolve())
+	}
+
+	// The empty envvar wins over viper and the default
+	assert.Empty(t, opts.Namespace)
+	assert.Equal(t, []string{"https://a"}, codecOpts.CORSOrigins)
+}
+
+func TestTemporalOptsValidate(t *testing.T) {
+	tests := []struct {
+		Name  string
+		Opts  TemporalOpts
+		Error bool
+	}{
+		{
+			Name: "empty",
+		},
+		{
+			Name: "mtls",
+			Opts: TemporalOpts{MTLSCertPath: "cert.pem", MTLSKeyPath: "cert.key"},
+		},
+		{
+			Name:  "cert without key",
+			Opts:  TemporalOpts{MTLSCertPath: "cert.pem"},
+			Error: true,
+		},
+		{
+			Name:  "api key and mtls",
+			Opts:  TemporalOpts{APIKey: "key", MTLSCertPath: "cert.pem", MTLSKeyPath: "cert.key"},
+			Error: true,
+		},
+		{
+			Name:  "api key and api key file",
+			Opts:  TemporalOpts{APIKey: "key", APIKeyFile: "key.txt"},
+			Error: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			err := test.Opts.Validate()
+			if test.Error {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestParseCobraOptsInvalid(t *testing.T) {
+	_, err := applyOptions(ParseCobraOpts(&TemporalOpts{MTLSKeyPath: "cert.key"})...)
+	assert.ErrorContains(t, err, "tls-client-cert-path")
+
+	o, err := applyOptions(ParseCobraOpts(&TemporalOpts{Address: "temporal:7233"})...)
+	require.NoError(t, err)
+	assert.Equal(t, "temporal:7233", o.HostPort)
+}
+
+func TestParseCobraOptsProfile(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "temporal.toml")
+	require.NoError(t, os.WriteFile(configFile, []byte(`
+[profile.default]
+address = "localhost:7233"
+
+[profile.staging]
+address = "staging.tmprl.cloud:7233"
+namespace = "staging"
+api_key = "staging-key"
+
+[profile.staging.grpc_meta]
+tenant = "acme"
+`), 0o600))
+
+	tests := []struct {
+		Name       string
+		Args       []string
+		Address    string
+		Namespace  string
+		TLSEnabled bool
+		Error      bool
+	}{
+		{
+			Name:       "profile",
+			Args:       []string{"--temporal-profile", "staging"},
+			Address:    "staging.tmprl.cloud:7233",
+			Namespace:  "staging",
+			TLSEnabled: true,
+		},
+		{
+			Name:       "flags override profile",
+			Args:       []string{"--temporal-profile", "staging", "-n", "other"},
+			Address:    "staging.tmprl.cloud:7233",
+			Namespace:  "other",
+			TLSEnabled: true,
+		},
+		{
+			Name:      "default profile",
+			Address:   "localhost:7233",
+			Namespace: "default",
+		},
+		{
+			Name:  "unknown profile",
+			Args:  []string{"--temporal-profile", "unknown"},
+			Error: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			cmd := &cobra.Command{}
+			opts := NewCobraOpts(cmd, &TemporalOpts{}, WithCobraViper(viper.New()))
+			require.NoError(t, cmd.Flags().Parse(append([]string{"--temporal-config-file", configFile}, test.Args...)))
+
+			o, err := applyOptions(ParseCobraOpts(opts)...)
+			if test.Error {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			assert.Equal(t, test.Address, o.HostPort)
+			assert.Equal(t, test.Namespace, o.Namespace)
+			assert.Equal(t, test.TLSEnabled, o.ConnectionOptions.TLS != nil)
+
+			if test.TLSEnabled {
+				headers, err := o.HeadersProvider.GetHeaders(context.Background())
+				require.NoError(t, err)
+				assert.Equal(t, "acme", headers["tenant"])
+				assert.NotNil(t, o.Credentials)
+			}
+		})
+	}
+}
@@ -0,0 +1,309 @@
+/*
+ * Copyright 2023 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package temporal
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mrsimonemms/golang-helpers/logger"
+	"github.com/spf13/cobra"
+	"go.temporal.io/sdk/converter"
+)
+
+// NamespaceHeader is sent by the Temporal UI and CLI with the namespace the
+// payloads belong to
+const NamespaceHeader = "X-Namespace"
+
+type CodecServerOpts struct {
+	ListenAddress string
+	CORSOrigins   []string
+	Namespaces    []string
+	AuthToken     string
+	TLSCertPath   string
+	TLSKeyPath    string
+
+	// Set by NewCodecServerCobraOpts to read the values when the command runs
+	flags flagBindings
+}
+
+type CodecServerOption func(*codecServer)
+
+type codecServer struct {
+	opts         *CodecServerOpts
+	codec        http.Handler
+	validateAuth func(r *http.Request) error
+	maxBodySize  int64
+	cobraOpts    []CobraOption
+}
+
+// WithCodecServerCobraOptions sets how NewCodecServerCmd reads its flags,
+// such as the viper instance and envvar prefix
+func WithCodecServerCobraOptions(cobraOpts ...CobraOption) CodecServerOption {
+	return func(s *codecServer) {
+		s.cobraOpts = append(s.cobraOpts, cobraOpts...)
+	}
+}
+
+// WithCodecServerMaxBodySize sets the largest request body in bytes.
+// Defaults to 16MiB.
+func WithCodecServerMaxBodySize(maxBodySize int64) CodecServerOption {
+	return func(s *codecServer) {
+		s.maxBodySize = maxBodySize
+	}
+}
+
+// WithCodecServerAuth validates each request, for example checking the JWT
+// the Temporal UI sends in the Authorization header. Requests are rejected if
+// it returns an error. This is in addition to any auth token.
+func WithCodecServerAuth(validate func(r *http.Request) error) CodecServerOption {
+	return func(s *codecServer) {
+		s.validateAuth = validate
+	}
+}
+
+// NewCodecServerCobraOpts adds the codec server flags to the command. Each
+// flag can also be set by an envvar or viper, and the values are read by
+// Resolve.
+func NewCodecServerCobraOpts(cmd *cobra.Command, opts *CodecServerOpts, cobraOpts ...CobraOption) *CodecServerOpts {
+	cfg := newCobraConfig(cobraOpts)
+
+	bindString := func(p *string, key, flag string) {
+		bindFlag(cfg, cmd, &opts.flags, p, key, flag, cfg.viper.GetString)
+	}
+	bindStringSlice := func(p *[]string, key, flag string) {
+		bindFlag(cfg, cmd, &opts.flags, p, key, flag, cfg.viper.GetStringSlice)
+	}
+
+	cmd.Flags().StringVar(
+		&opts.ListenAddress, "codec-listen-address",
+		"0.0.0.0:8081", "Address of codec server",
+	)
+	bindString(&opts.ListenAddress, "codec_listen_address", "codec-listen-address")
+
+	cmd.Flags().StringSliceVar(
+		&opts.CORSOrigins, "codec-cors-origin",
+		nil, "Origins allowed to call the codec server, such as the Temporal UI",
+	)
+	bindStringSlice(&opts.CORSOrigins, "codec_cors_origin", "codec-cors-origin")
+
+	cmd.Flags().StringSliceVar(
+		&opts.Namespaces, "codec-namespace",
+		nil, "Namespaces allowed to use the codec server. Defaults to all.",
+	)
+	bindStringSlice(&opts.Namespaces, "codec_namespace", "codec-namespace")
+
+	cmd.Flags().StringVar(
+		&opts.AuthToken, "codec-auth-token",
+		"", "Bearer token required in the Authorization header",
+	)
+	bindString(&opts.AuthToken, "codec_auth_token", "codec-auth-token")
+
+	cmd.Flags().StringVar(
+		&opts.TLSCertPath, "codec-tls-cert-path",
+		"", "Path to TLS cert for the codec server",
+	)
+	bindString(&opts.TLSCertPath, "codec_tls_cert_path", "codec-tls-cert-path")
+
+	cmd.Flags().StringVar(
+		&opts.TLSKeyPath, "codec-tls-key-path",
+		"", "Path to TLS key for the codec server",
+	)
+	bindString(&opts.TLSKeyPath, "codec_tls_key_path", "codec-tls-key-path")
+
+	return opts
+}
+
+// Resolve reads the flag values from the command line, envvars and viper,
+// and validates them. NewCodecServerCmd calls this before serving.
+func (o *CodecServerOpts) Resolve() error {
+	if err := o.flags.resolve(); err != nil {
+		return err
+	}
+
+	if o.AuthToken != "" {
+		logger.AddSecret(o.AuthToken)
+	}
+
+	if (o.TLSCertPath == "") != (o.TLSKeyPath == "") {
+		return errors.New("codec-tls-cert-path and codec-tls-key-path must be set together")
+	}
+
+	return nil
+}
+
+// NewCodecServerCmd creates a command that serves the codec over the codec
+// server protocol, so the Temporal UI and CLI can show encoded payloads
+func NewCodecServerCmd(codec converter.PayloadCodec, options ...CodecServerOption) *cobra.Command {
+	var opts CodecServerOpts
+
+	cmd := &cobra.Command{
+		Use:   "codec-server",
+		Short: "Run a codec server for the Temporal UI and CLI",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Read the values from the flags, envvars and config file
+			if err := opts.Resolve(); err != nil {
+				return err
+			}
+
+			return ServeCodec(cmd.Context(), codec, &opts, options...)
+		},
+	}
+
+	s := &codecServer{}
+	for _, o := range options {
+		o(s)
+	}
+	NewCodecServerCobraOpts(cmd, &opts, s.cobraOpts...)
+
+	return cmd
+}
+
+// NewCodecServerHandler creates the handler for the /encode and /decode
+// endpoints, for mounting on an existing server
+func NewCodecServerHandler(codec converter.PayloadCodec, opts *CodecServerOpts, options ...CodecServerOption) http.Handler {
+	s := &codecServer{
+		opts:        opts,
+		codec:       converter.NewPayloadCodecHTTPHandler(codec),
+		maxBodySize: 16 * 1024 * 1024,
+	}
+	for _, o := range options {
+		o(s)
+	}
+	return s
+}
+
+// ServeCodec serves the codec until the context is cancelled
+func ServeCodec(ctx context.Context, codec converter.PayloadCodec, opts *CodecServerOpts, options ...CodecServerOption) error {
+	lis, err := net.Listen("tcp", opts.ListenAddress) //nolint:noctx // The listener outlives any context here
+	if err != nil {
+		return fmt.Errorf("error listening for codec server: %w", err)
+	}
+
+	if opts.TLSCertPath != "" || opts.TLSKeyPath != "" {
+		cert, err := tls.LoadX509KeyPair(opts.TLSCertPath, opts.TLSKeyPath)
+		if err != nil {
+			_ = lis.Close()
+			return fmt.Errorf("error loading codec server tls key pair: %w", err)
+		}
+		lis = tls.NewListener(lis, &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		})
+	}
+
+	srv := &http.Server{
+		Handler:           NewCodecServerHandler(codec, opts, options...),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		defer cancel()
+
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			logger.Default().Error("Error shutting down codec server", "error", err)
+		}
+	}()
+
+	logger.Default().Info("Starting codec server",
+		"address", lis.Addr().String(),
+		"tls", opts.TLSCertPath != "",
+	)
+
+	if err := srv.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("error serving codec server: %w", err)
+	}
+	return nil
+}
+
+func (s *codecServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.cors(w, r)
+
+	// Preflight requests don't have the auth headers
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if len(s.opts.Namespaces) > 0 && !slices.Contains(s.opts.Namespaces, r.Header.Get(NamespaceHeader)) {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	if err := s.authorise(r); err != nil {
+		logger.Default().Warn("Unauthorised codec server request",
+			"error", err,
+			"namespace", r.Header.Get(NamespaceHeader),
+		)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxBodySize)
+
+	s.codec.ServeHTTP(w, r)
+}
+
+func (s *codecServer) cors(w http.ResponseWriter, r *http.Request) {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return
+	}
+
+	h := w.Header()
+	switch {
+	case slices.Contains(s.opts.CORSOrigins, origin):
+		h.Set("Access-Control-Allow-Origin", origin)
+		h.Set("Access-Control-Allow-Credentials", "true")
+		h.Add("Vary", "Origin")
+	case slices.Contains(s.opts.CORSOrigins, "*"):
+		// Browsers don't send credentials to a wildcard, so any site can't
+		// call it as the user
+		h.Set("Access-Control-Allow-Origin", "*")
+	default:
+		return
+	}
+
+	h.Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	h.Set("Access-Control-Allow-Headers", "Content-Type, Authorization, "+NamespaceHeader)
+}
+
+func (s *codecServer) authorise(r *http.Request) error {
+	if s.opts.AuthToken != "" {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.opts.AuthToken)) != 1 {
+			return errors.New("invalid auth token")
+		}
+	}
+
+	if s.validateAuth != nil {
+		return s.validateAuth(r)
+	}
+
+	return nil
+}
@@ -0,0 +1,179 @@
+/*
+ * Copyright 2023 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package temporal
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	commonpb "go.temporal.io/api/common/v1"
+	"go.temporal.io/sdk/converter"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+func TestCodecServerHandler(t *testing.T) {
+	codec, err := NewEncryptionCodec(EncryptionKey{ID: "key", Key: bytes.Repeat([]byte{1}, 32)})
+	require.NoError(t, err)
+
+	encoded, err := codec.Encode([]*commonpb.Payload{{Data: []byte(`"hello"`)}})
+	require.NoError(t, err)
+	body, err := protojson.Marshal(&commonpb.Payloads{Payloads: encoded})
+	require.NoError(t, err)
+
+	h := NewCodecServerHandler(codec, &CodecServerOpts{
+		CORSOrigins: []string{"http://localhost:8233"},
+		Namespaces:  []string{"default"},
+		AuthToken:   "token",
+	}, WithCodecServerAuth(func(r *http.Request) error {
+		if r.Header.Get("X-Reject") != "" {
+			return errors.New("rejected")
+		}
+		return nil
+	}))
+
+	tests := []struct {
+		Name     string
+		Method   string
+		Headers  map[string]string
+		Status   int
+		CORS     bool
+		Contains string
+	}{
+		{
+			Name:     "decode",
+			Method:   http.MethodPost,
+			Headers:  map[string]string{NamespaceHeader: "default", "Authorization": "Bearer token", "Origin": "http://localhost:8233"},
+			Status:   http.StatusOK,
+			CORS:     true,
+			Contains: base64.StdEncoding.EncodeToString([]byte(`"hello"`)),
+		},
+		{
+			Name:    "preflight",
+			Method:  http.MethodOptions,
+			Headers: map[string]string{"Origin": "http://localhost:8233"},
+			Status:  http.StatusOK,
+			CORS:    true,
+		},
+		{
+			Name:    "unknown origin",
+			Method:  http.MethodOptions,
+			Headers: map[string]string{"Origin": "http://example.com"},
+			Status:  http.StatusOK,
+		},
+		{
+			Name:    "wrong namespace",
+			Method:  http.MethodPost,
+			Headers: map[string]string{NamespaceHeader: "other", "Authorization": "Bearer token"},
+			Status:  http.StatusForbidden,
+		},
+		{
+			Name:    "wrong token",
+			Method:  http.MethodPost,
+			Headers: map[string]string{NamespaceHeader: "default", "Authorization": "Bearer wrong"},
+			Status:  http.StatusUnauthorized,
+		},
+		{
+			Name:    "rejected by validator",
+			Method:  http.MethodPost,
+			Headers: map[string]string{NamespaceHeader: "default", "Authorization": "Bearer token", "X-Reject": "true"},
+			Status:  http.StatusUnauthorized,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			req := httptest.NewRequest(test.Method, "/decode", bytes.NewReader(body))
+			for k, v := range test.Headers {
+				req.Header.Set(k, v)
+			}
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			assert.Equal(t, test.Status, rec.Code)
+			assert.Equal(t, test.CORS, rec.Header().Get("Access-Control-Allow-Origin") != "")
+			if test.Contains != "" {
+				assert.Contains(t, rec.Body.String(), test.Contains)
+			}
+		})
+	}
+}
+
+func TestCodecServerCORSWildcard(t *testing.T) {
+	h := NewCodecServerHandler(converter.NewZlibCodec(converter.ZlibCodecOptions{}), &CodecServerOpts{
+		CORSOrigins: []string{"*"},
+	})
+
+	req := httptest.NewRequest(http.MethodOptions, "/decode", nil)
+	req.Header.Set("Origin", "http://example.com")
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	assert.Equal(t, "*", rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Credentials"))
+}
+
+func TestCodecServerMaxBodySize(t *testing.T) {
+	h := NewCodecServerHandler(converter.NewZlibCodec(converter.ZlibCodecOptions{}), &CodecServerOpts{},
+		WithCodecServerMaxBodySize(10))
+
+	body, err := protojson.Marshal(&commonpb.Payloads{Payloads: []*commonpb.Payload{{Data: []byte(`"hello world"`)}}})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/decode", bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestNewCodecServerCobraOpts(t *testing.T) {
+	v := viper.New()
+	v.Set("codec_namespace", []string{"from-viper"})
+	t.Setenv("MYAPP_CODEC_CORS_ORIGIN", "http://localhost:8233,https://cloud.temporal.io")
+
+	first := &cobra.Command{Use: "first"}
+	firstOpts := NewCodecServerCobraOpts(first, &CodecServerOpts{}, WithCobraViper(v), WithCobraEnvPrefix("myapp"))
+
+	second := &cobra.Command{Use: "second"}
+	secondOpts := NewCodecServerCobraOpts(second, &CodecServerOpts{}, WithCobraViper(v), WithCobraEnvPrefix("myapp"))
+
+	require.NoError(t, first.Flags().Parse([]string{"--codec-listen-address", "localhost:9000"}))
+	require.NoError(t, second.Flags().Parse(nil))
+
+	require.NoError(t, firstOpts.Resolve())
+	require.NoError(t, secondOpts.Resolve())
+
+	assert.Equal(t, "localhost:9000", firstOpts.ListenAddress)
+	assert.Equal(t, "0.0.0.0:8081", secondOpts.ListenAddress)
+	assert.Equal(t, []string{"http://localhost:8233", "https://cloud.temporal.io"}, secondOpts.CORSOrigins)
+	assert.Equal(t, []string{"from-viper"}, secondOpts.Namespaces)
+
+	third := &cobra.Command{Use: "third"}
+	thirdOpts := NewCodecServerCobraOpts(third, &CodecServerOpts{}, WithCobraViper(v))
+	require.NoError(t, third.Flags().Parse([]string{"--codec-tls-cert-path", "cert.pem"}))
+	assert.Error(t, thirdOpts.Resolve())
+}
@@ -0,0 +1,233 @@
+/*
+ * Copyright 2023 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package temporal
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	commonpb "go.temporal.io/api/common/v1"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/converter"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// MetadataEncodingCompressed is the encoding of compressed payloads
+	MetadataEncodingCompressed = "binary/compressed"
+	// MetadataCompression is the algorithm that compressed the payload
+	MetadataCompression = "compression"
+)
+
+type CompressionAlgorithm string
+
+const (
+	CompressionZstd CompressionAlgorithm = "zstd"
+	CompressionGzip CompressionAlgorithm = "gzip"
+)
+
+type CompressionOption func(*CompressionCodec)
+
+// CompressionCodec compresses payloads larger than the threshold. Smaller
+// payloads, and those that don't get smaller, are left as they are.
+type CompressionCodec struct {
+	algorithm CompressionAlgorithm
+	threshold int
+	maxSize   int64
+	metrics   client.MetricsHandler
+
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+}
+
+// WithCompressionAlgorithm sets the algorithm for new payloads. Payloads are
+// decompressed with whichever algorithm compressed them. Defaults to zstd.
+func WithCompressionAlgorithm(algorithm CompressionAlgorithm) CompressionOption {
+	return func(c *CompressionCodec) {
+		c.algorithm = algorithm
+	}
+}
+
+// WithCompressionThreshold sets the size in bytes above which payloads are
+// compressed. Defaults to 1KiB.
+func WithCompressionThreshold(threshold int) CompressionOption {
+	return func(c *CompressionCodec) {
+		c.threshold = threshold
+	}
+}
+
+// WithCompressionMaxSize sets the largest size in bytes a payload can
+// decompress to, so a small payload can't expand to fill the memory. Defaults
+// to 64MiB.
+func WithCompressionMaxSize(maxSize int64) CompressionOption {
+	return func(c *CompressionCodec) {
+		c.maxSize = maxSize
+	}
+}
+
+// WithCompressionMetrics records the payload sizes before and after
+// compression, so the compression ratio can be tracked. Use the same metrics
+// handler as the client.
+func WithCompressionMetrics(metrics client.MetricsHandler) CompressionOption {
+	return func(c *CompressionCodec) {
+		c.metrics = metrics
+	}
+}
+
+// NewCompressionCodec creates the codec. Chain it with other codecs with
+// NewCodecDataConverter.
+func NewCompressionCodec(opts ...CompressionOption) (*CompressionCodec, error) {
+	c := &CompressionCodec{
+		algorithm: CompressionZstd,
+		threshold: 1024,
+		maxSize:   64 * 1024 * 1024,
+		metrics:   client.MetricsNopHandler,
+	}
+	for _, o := range opts {
+		o(c)
+	}
+
+	if c.algorithm != CompressionZstd && c.algorithm != CompressionGzip {
+		return nil, fmt.Errorf("unknown compression algorithm: %s", c.algorithm)
+	}
+	if c.maxSize <= 0 {
+		return nil, errors.New("compression max size must be positive")
+	}
+
+	var err error
+	if c.zstdEncoder, err = zstd.NewWriter(nil); err != nil {
+		return nil, fmt.Errorf("error creating zstd encoder: %w", err)
+	}
+	if c.zstdDecoder, err = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(uint64(c.maxSize))); err != nil {
+		return nil, fmt.Errorf("error creating zstd decoder: %w", err)
+	}
+
+	return c, nil
+}
+
+// Encode compresses each payload above the threshold
+func (c *CompressionCodec) Encode(payloads []*commonpb.Payload) ([]*commonpb.Payload, error) {
+	result := make([]*commonpb.Payload, len(payloads))
+	for i, p := range payloads {
+		data, err := proto.Marshal(p)
+		if err != nil {
+			return nil, fmt.Errorf("error marshalling payload: %w", err)
+		}
+
+		if len(data) <= c.threshold {
+			result[i] = p
+			continue
+		}
+
+		compressed, err := c.compress(data)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(compressed) >= len(data) {
+			c.metrics.Counter("payload_compression_skipped").Inc(1)
+			result[i] = p
+			continue
+		}
+
+		metrics := c.metrics.WithTags(map[string]string{MetadataCompression: string(c.algorithm)})
+		metrics.Counter("payload_compression_input_bytes").Inc(int64(len(data)))
+		metrics.Counter("payload_compression_output_bytes").Inc(int64(len(compressed)))
+		metrics.Gauge("payload_compression_ratio").Update(float64(len(compressed)) / float64(len(data)))
+
+		result[i] = &commonpb.Payload{
+			Metadata: map[string][]byte{
+				converter.MetadataEncoding: []byte(MetadataEncodingCompressed),
+				MetadataCompression:        []byte(c.algorithm),
+			},
+			Data: compressed,
+		}
+	}
+
+	return result, nil
+}
+
+// Decode decompresses each compressed payload. Other payloads are returned
+// unchanged.
+func (c *CompressionCodec) Decode(payloads []*commonpb.Payload) ([]*commonpb.Payload, error) {
+	result := make([]*commonpb.Payload, len(payloads))
+	for i, p := range payloads {
+		if string(p.GetMetadata()[converter.MetadataEncoding]) != MetadataEncodingCompressed {
+			result[i] = p
+			continue
+		}
+
+		data, err := c.decompress(CompressionAlgorithm(p.GetMetadata()[MetadataCompression]), p.GetData())
+		if err != nil {
+			return nil, err
+		}
+
+		result[i] = &commonpb.Payload{}
+		if err := proto.Unmarshal(data, result[i]); err != nil {
+			return nil, fmt.Errorf("error unmarshalling payload: %w", err)
+		}
+	}
+
+	return result, nil
+}
+
+func (c *CompressionCodec) compress(data []byte) ([]byte, error) {
+	if c.algorithm == CompressionZstd {
+		return c.zstdEncoder.EncodeAll(data, nil), nil
+	}
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, fmt.Errorf("error compressing payload: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("error compressing payload: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *CompressionCodec) decompress(algorithm CompressionAlgorithm, data []byte) ([]byte, error) {
+	switch algorithm {
+	case CompressionZstd:
+		out, err := c.zstdDecoder.DecodeAll(data, nil)
+		if err != nil {
+			return nil, fmt.Errorf("error decompressing zstd payload: %w", err)
+		}
+		return out, nil
+	case CompressionGzip:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("error decompressing gzip payload: %w", err)
+		}
+		// Read one byte over, to tell a payload at the limit from one over it
+		out, err := io.ReadAll(io.LimitReader(r, c.maxSize+1))
+		if err != nil {
+			return nil, fmt.Errorf("error decompressing gzip payload: %w", err)
+		}
+		if int64(len(out)) > c.maxSize {
+			return nil, fmt.Errorf("decompressed payload larger than %d bytes", c.maxSize)
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("unknown compression algorithm: %s", algorithm)
+	}
+}
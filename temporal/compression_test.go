@@ -0,0 +1,134 @@
+/*
+ * Copyright 2023 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package temporal
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally/v4"
+	sdktally "go.temporal.io/sdk/contrib/tally"
+)
+
+func TestCompressionCodec(t *testing.T) {
+	large := strings.Repeat("compress me ", 1000)
+
+	tests := []struct {
+		Name       string
+		Options    []CompressionOption
+		Value      string
+		Compressed bool
+	}{
+		{
+			Name:       "zstd",
+			Value:      large,
+			Compressed: true,
+		},
+		{
+			Name:       "gzip",
+			Options:    []CompressionOption{WithCompressionAlgorithm(CompressionGzip)},
+			Value:      large,
+			Compressed: true,
+		},
+		{
+			Name:  "below threshold",
+			Value: "small",
+		},
+		{
+			Name:    "above custom threshold",
+			Options: []CompressionOption{WithCompressionThreshold(1 << 20)},
+			Value:   large,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			scope := tally.NewTestScope("", nil)
+
+			codec, err := NewCompressionCodec(append(test.Options, WithCompressionMetrics(sdktally.NewMetricsHandler(scope)))...)
+			require.NoError(t, err)
+
+			dc := NewCodecDataConverter(codec)
+
+			payload, err := dc.ToPayload(test.Value)
+			require.NoError(t, err)
+			assert.Equal(t, test.Compressed, string(payload.Metadata["encoding"]) == MetadataEncodingCompressed)
+
+			var value string
+			require.NoError(t, dc.FromPayload(payload, &value))
+			assert.Equal(t, test.Value, value)
+
+			assert.Equal(t, test.Compressed, len(scope.Snapshot().Gauges()) > 0)
+		})
+	}
+}
+
+func TestCompressionCodecChained(t *testing.T) {
+	encryption, err := NewEncryptionCodec(EncryptionKey{ID: "key", Key: bytes.Repeat([]byte{1}, 32)})
+	require.NoError(t, err)
+	compression, err := NewCompressionCodec()
+	require.NoError(t, err)
+
+	// Compressed before it's encrypted
+	dc := NewCodecDataConverter(encryption, compression)
+
+	large := strings.Repeat("compress me ", 1000)
+	payload, err := dc.ToPayload(large)
+	require.NoError(t, err)
+	assert.Equal(t, MetadataEncodingEncrypted, string(payload.Metadata["encoding"]))
+	assert.Less(t, len(payload.Data), len(large))
+
+	var value string
+	require.NoError(t, dc.FromPayload(payload, &value))
+	assert.Equal(t, large, value)
+}
+
+func TestNewCompressionCodecErrors(t *testing.T) {
+	_, err := NewCompressionCodec(WithCompressionAlgorithm("lz4"))
+	assert.Error(t, err)
+
+	_, err = NewCompressionCodec(WithCompressionMaxSize(0))
+	assert.Error(t, err)
+}
+
+func TestCompressionCodecMaxSize(t *testing.T) {
+	large := strings.Repeat("x", 64*1024)
+
+	for _, algorithm := range []CompressionAlgorithm{CompressionZstd, CompressionGzip} {
+		t.Run(string(algorithm), func(t *testing.T) {
+			codec, err := NewCompressionCodec(WithCompressionAlgorithm(algorithm))
+			require.NoError(t, err)
+
+			payload, err := NewCodecDataConverter(codec).ToPayload(large)
+			require.NoError(t, err)
+			assert.Less(t, len(payload.Data), 1024)
+
+			// The payload is tiny, but expands past the limit
+			limited, err := NewCompressionCodec(WithCompressionAlgorithm(algorithm), WithCompressionMaxSize(32*1024))
+			require.NoError(t, err)
+
+			var value string
+			assert.Error(t, NewCodecDataConverter(limited).FromPayload(payload, &value))
+
+			require.NoError(t, NewCodecDataConverter(codec).FromPayload(payload, &value))
+			assert.Equal(t, large, value)
+		})
+	}
+}
@@ -17,16 +17,33 @@
 package temporal
 
 import (
+	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
-
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	gh "github.com/mrsimonemms/golang-helpers"
 	prom "github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 	"go.temporal.io/sdk/client"
 	"go.temporal.io/sdk/contrib/envconfig"
+	sdkotel "go.temporal.io/sdk/contrib/opentelemetry"
 	"go.temporal.io/sdk/converter"
+	"go.temporal.io/sdk/interceptor"
 	"go.temporal.io/sdk/log"
 	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+	"google.golang.org/grpc"
 )
 
 type Options func(*client.Options) error
@@ -34,13 +51,38 @@ type Options func(*client.Options) error
 type TLSOptions func(*tls.Config) error
 
 // Create a connection to Temporal
-func newConnection(clientOptions *client.Options, options ...Options) (client.Client, error) {
+func newConnection(connector *Connector, clientOptions *client.Options, options ...Options) (client.Client, error) {
 	for _, o := range options {
 		if err := o(clientOptions); err != nil {
 			return nil, err
 		}
 	}
-	return client.Dial(*clientOptions)
+	if clientOptions.Logger == nil {
+		// Default to the shared logger so the SDK logs in the same format as everything else
+		clientOptions.Logger = NewSlogHandler(nil)
+	}
+	// Workers created from this client get this too, so activities have a request-scoped logger
+	clientOptions.Interceptors = append(clientOptions.Interceptors, NewLoggerInterceptor())
+	return connector.dial(*clientOptions)
+}
+
+func newConnectionWithEnvvars(connector *Connector, options ...Options) (client.Client, error) {
+	clientOptions, err := envconfig.LoadDefaultClientOptions()
+	if err != nil {
+		return nil, fmt.Errorf("error loading environment config: %w", err)
+	}
+
+	// Credentials from the environment are only used if none are given, so
+	// the options override them rather than conflict
+	credentials := clientOptions.Credentials
+	clientOptions.Credentials = nil
+
+	return newConnection(connector, &clientOptions, append(options, func(o *client.Options) error {
+		if o.Credentials == nil {
+			o.Credentials = credentials
+		}
+		return nil
+	})...)
 }
 
 // NewConnectionWithEnvvars
@@ -50,28 +92,34 @@ func newConnection(clientOptions *client.Options, options ...Options) (client.Cl
 //
 // @link https://docs.temporal.io/develop/environment-configuration#sdk-usage-example-go
 func NewConnectionWithEnvvars(options ...Options) (client.Client, error) {
-	clientOptions, err := envconfig.LoadDefaultClientOptions()
-	if err != nil {
-		return nil, fmt.Errorf("error loading environment config: %w", err)
-	}
-
-	return newConnection(&clientOptions, options...)
+	return newConnectionWithEnvvars(&Connector{}, options...)
 }
 
 // New Connection
 //
-// Create a Temporal connection and only use options that are supplied
+// Create a Temporal connection and only use options that are supplied. Use a
+// Connector to retry or control how it connects.
 func NewConnection(options ...Options) (client.Client, error) {
-	clientOptions := &client.Options{}
-	return newConnection(clientOptions, options...)
+	return newConnection(&Connector{}, &client.Options{}, options...)
 }
 
+// WithAPICredentials authenticates with the API key. It can be an env:// or
+// file:// reference - files are re-read when they change.
 func WithAPICredentials(apiKey string) Options {
 	return func(o *client.Options) error {
-		if apiKey != "" {
-			return WithCredentials(client.NewAPIKeyStaticCredentials(apiKey))(o)
+		if apiKey == "" {
+			return nil
 		}
-		return nil
+		if path, ok := strings.CutPrefix(apiKey, SecretFilePrefix); ok {
+			return WithAPIKeyFile(path)(o)
+		}
+
+		// This also makes sure the key never appears in the logs
+		key, err := ResolveSecret(apiKey)
+		if err != nil {
+			return err
+		}
+		return WithCredentials(client.NewAPIKeyStaticCredentials(key))(o)
 	}
 }
 
@@ -87,15 +135,64 @@ func WithAuthDetection(apiKey, certPath, certKey string) Options {
 	return WithNoOp()
 }
 
+// WithConnectionOptions merges the connection options with any set earlier.
+// Dial options are added, and other fields are only set if they're not the
+// zero value. Setting a field to a different value is an error, so settings
+// aren't lost.
 func WithConnectionOptions(connection *client.ConnectionOptions) Options {
 	return func(o *client.Options) error {
-		o.ConnectionOptions = *connection
+		dst := &o.ConnectionOptions
+
+		if connection.TLS != nil && dst.TLS != nil && connection.TLS != dst.TLS {
+			return errors.New("conflicting connection option: tls config already set, use WithTLS options to change it")
+		}
+
+		err := errors.Join(
+			mergeOption("TLS", &dst.TLS, connection.TLS),
+			mergeOption("TLSDisabled", &dst.TLSDisabled, connection.TLSDisabled),
+			mergeOption("Authority", &dst.Authority, connection.Authority),
+			mergeOption("DisableKeepAliveCheck", &dst.DisableKeepAliveCheck, connection.DisableKeepAliveCheck),
+			mergeOption("KeepAliveTime", &dst.KeepAliveTime, connection.KeepAliveTime),
+			mergeOption("KeepAliveTimeout", &dst.KeepAliveTimeout, connection.KeepAliveTimeout),
+			mergeOption("GetSystemInfoTimeout", &dst.GetSystemInfoTimeout, connection.GetSystemInfoTimeout),
+			mergeOption(
+				"DisableKeepAlivePermitWithoutStream",
+				&dst.DisableKeepAlivePermitWithoutStream,
+				connection.DisableKeepAlivePermitWithoutStream,
+			),
+			mergeOption("MaxPayloadSize", &dst.MaxPayloadSize, connection.MaxPayloadSize),
+			mergeOption("GrpcCompression", &dst.GrpcCompression, connection.GrpcCompression),
+		)
+		if err != nil {
+			return err
+		}
+
+		dst.DialOptions = append(dst.DialOptions, connection.DialOptions...)
+		return nil
+	}
+}
+
+// mergeOption sets the value unless it's the zero value. It's an error to
+// change a value that's already set.
+func mergeOption[T comparable](name string, dst *T, value T) error {
+	var zero T
+	if value == zero {
 		return nil
 	}
+	if *dst != zero && *dst != value {
+		return fmt.Errorf("conflicting connection option: %s already set", name)
+	}
+	*dst = value
+	return nil
 }
 
+// WithCredentials sets the credentials. Only one set of credentials can be
+// used, so it's an error if they've already been set.
 func WithCredentials(credential client.Credentials) Options {
 	return func(o *client.Options) error {
+		if o.Credentials != nil {
+			return errors.New("conflicting connection option: credentials already set")
+		}
 		o.Credentials = credential
 		return nil
 	}
@@ -118,6 +215,22 @@ func WithDataAndFailureConverter(cvt converter.DataConverter) Options {
 	}
 }
 
+// WithContextPropagators adds propagators that copy values from the context
+// into workflows and activities
+func WithContextPropagators(propagators ...workflow.ContextPropagator) Options {
+	return func(o *client.Options) error {
+		o.ContextPropagators = append(o.ContextPropagators, propagators...)
+		return nil
+	}
+}
+
+// WithDialOptions adds gRPC dial options to the connection
+func WithDialOptions(opts ...grpc.DialOption) Options {
+	return WithConnectionOptions(&client.ConnectionOptions{
+		DialOptions: opts,
+	})
+}
+
 func WithFailureConverter(cvt converter.DataConverter) Options {
 	return func(o *client.Options) error {
 		o.FailureConverter = temporal.NewDefaultFailureConverter(
@@ -130,6 +243,103 @@ func WithFailureConverter(cvt converter.DataConverter) Options {
 	}
 }
 
+// WithGRPCMetadata adds static gRPC metadata to every request, for example
+// for a proxy in front of Temporal. Metadata from each call is merged, and
+// it's an error to give a key a different value. It overrides metadata from
+// a headers provider set another way, such as envconfig.
+func WithGRPCMetadata(md map[string]string) Options {
+	return func(o *client.Options) error {
+		if len(md) == 0 {
+			return nil
+		}
+
+		headers := grpcHeadersFor(o)
+		for k, v := range md {
+			if existing, ok := headers.static[k]; ok && existing != v {
+				return fmt.Errorf("conflicting connection option: grpc metadata %s already set", k)
+			}
+			headers.static[k] = v
+		}
+		return nil
+	}
+}
+
+// WithHeaders adds gRPC metadata to every request. The static metadata is
+// merged as WithGRPCMetadata, and the providers are called for each request,
+// for example to add a tenant ID from the context for a proxy. Values from
+// the providers take precedence.
+func WithHeaders(static map[string]string, providers ...HeadersProvider) Options {
+	return func(o *client.Options) error {
+		if len(static) == 0 && len(providers) == 0 {
+			return nil
+		}
+
+		if err := WithGRPCMetadata(static)(o); err != nil {
+			return err
+		}
+
+		headers := grpcHeadersFor(o)
+		headers.providers = append(headers.providers, providers...)
+		return nil
+	}
+}
+
+// HeadersProvider provides gRPC metadata for each request. It matches the
+// Temporal SDK's interface, which isn't exported.
+type HeadersProvider interface {
+	GetHeaders(ctx context.Context) (map[string]string, error)
+}
+
+// HeadersFunc provides the gRPC metadata for each request
+type HeadersFunc func(ctx context.Context) (map[string]string, error)
+
+func (f HeadersFunc) GetHeaders(ctx context.Context) (map[string]string, error) {
+	return f(ctx)
+}
+
+// grpcHeaders is the headers provider for WithGRPCMetadata and WithHeaders
+type grpcHeaders struct {
+	// base is a provider set some other way, such as by envconfig
+	base      HeadersProvider
+	static    map[string]string
+	providers []HeadersProvider
+}
+
+func grpcHeadersFor(o *client.Options) *grpcHeaders {
+	headers, ok := o.HeadersProvider.(*grpcHeaders)
+	if !ok {
+		headers = &grpcHeaders{
+			base:   o.HeadersProvider,
+			static: map[string]string{},
+		}
+		o.HeadersProvider = headers
+	}
+	return headers
+}
+
+func (h *grpcHeaders) GetHeaders(ctx context.Context) (map[string]string, error) {
+	headers := map[string]string{}
+
+	if h.base != nil {
+		md, err := h.base.GetHeaders(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error getting grpc headers: %w", err)
+		}
+		maps.Copy(headers, md)
+	}
+	maps.Copy(headers, h.static)
+
+	for _, p := range h.providers {
+		md, err := p.GetHeaders(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error getting grpc headers: %w", err)
+		}
+		maps.Copy(headers, md)
+	}
+
+	return headers, nil
+}
+
 func WithHostPort(hostPort string) Options {
 	return func(o *client.Options) error {
 		if hostPort == "" {
@@ -140,32 +350,86 @@ func WithHostPort(hostPort string) Options {
 	}
 }
 
-func WithLogger(logger log.Logger) Options {
+// WithHostPortResolver connects to the endpoints from the resolver, such as
+// a DNS SRV record or a file, and balances requests between them. They're
+// resolved when the connection is dialled, within the dial context, and every
+// 30s after. The endpoints won't match the TLS certificate, so set the server
+// name with WithTLSServerName when using TLS.
+func WithHostPortResolver(r HostPortResolver) Options {
 	return func(o *client.Options) error {
-		o.Logger = logger
+		// Registered on this connection only, so it doesn't clash with others
+		o.HostPort = resolverScheme + ":///temporal"
+		o.ConnectionOptions.DialOptions = append(o.ConnectionOptions.DialOptions, grpc.WithResolvers(newHostPortBuilder(r)))
 		return nil
 	}
 }
 
-func WithMetrics(metrics client.MetricsHandler) Options {
+// WithIdentity sets the client identity, which is shown against workers and
+// in the workflow history. If empty, DefaultIdentity is used.
+func WithIdentity(identity string) Options {
 	return func(o *client.Options) error {
-		o.MetricsHandler = metrics
+		if identity == "" {
+			identity = DefaultIdentity()
+		}
+		o.Identity = identity
 		return nil
 	}
 }
 
-func WithMTLS(certPath, certKey string) Options {
+// DefaultIdentity is the pid, hostname and build version, such as
+// 1234@worker-abc@v1.2.3
+func DefaultIdentity() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	version := gh.Development
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		version = info.Main.Version
+	}
+
+	return fmt.Sprintf("%d@%s@%s", os.Getpid(), hostname, version)
+}
+
+// WithInterceptors adds interceptors to the client. Workers created from the
+// client use them too.
+func WithInterceptors(interceptors ...interceptor.ClientInterceptor) Options {
 	return func(o *client.Options) error {
-		// Use the crypto/tls package to create a cert object
-		cert, err := tls.LoadX509KeyPair(certPath, certKey)
-		if err != nil {
-			return fmt.Errorf("error loading tls key pair: %w", err)
-		}
+		o.Interceptors = append(o.Interceptors, interceptors...)
+		return nil
+	}
+}
 
-		return WithCredentials(client.NewMTLSCredentials(cert))(o)
+// WithKeepAlive sets how often the connection is checked when idle and how
+// long to wait for a response
+func WithKeepAlive(keepAliveTime, keepAliveTimeout time.Duration) Options {
+	return WithConnectionOptions(&client.ConnectionOptions{
+		KeepAliveTime:    keepAliveTime,
+		KeepAliveTimeout: keepAliveTimeout,
+	})
+}
+
+func WithLogger(l log.Logger) Options {
+	return func(o *client.Options) error {
+		o.Logger = l
+		return nil
 	}
 }
 
+func WithMetrics(metrics client.MetricsHandler) Options {
+	return func(o *client.Options) error {
+		o.MetricsHandler = metrics
+		return nil
+	}
+}
+
+// WithMTLS enables TLS and presents the client certificate. It's added to the
+// same TLS config as the WithTLS options, and reloaded when the files change.
+func WithMTLS(certPath, certKey string) Options {
+	return WithTLS(true, WithTLSClientCertFiles(certPath, certKey))
+}
+
 func WithNamespace(namespace string) Options {
 	return func(o *client.Options) error {
 		if namespace == "" {
@@ -182,38 +446,85 @@ func WithNoOp() Options {
 	}
 }
 
-func WithPrometheusMetrics(listenAddress, prefix string, registry *prom.Registry) Options {
+// WithOpenTelemetryMetrics creates a handler, as
+// NewOpenTelemetryMetricsHandler, and returns the option to record the client
+// metrics on it. Close the returned closer on shutdown to flush the metrics.
+func WithOpenTelemetryMetrics(
+	ctx context.Context,
+	prefix string,
+	opts ...OpenTelemetryMetricsOption,
+) (Options, io.Closer, error) {
+	metrics, closer, err := NewOpenTelemetryMetricsHandler(ctx, prefix, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return WithMetrics(metrics), closer, nil
+}
+
+// WithOpenTelemetryTracing traces workflows and activities with the tracer
+// provider, or the global one if nil. The trace context in the context given to
+// the client, such as from an incoming gRPC request, is the parent, and it's
+// propagated in the W3C format.
+func WithOpenTelemetryTracing(tp trace.TracerProvider) Options {
 	return func(o *client.Options) error {
-		metrics, err := NewPrometheusHandler(listenAddress, prefix, registry)
+		if tp == nil {
+			tp = otel.GetTracerProvider()
+		}
+
+		tracing, err := sdkotel.NewTracingInterceptor(sdkotel.TracerOptions{
+			Tracer:            tp.Tracer("temporal-sdk-go"),
+			TextMapPropagator: propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}),
+		})
 		if err != nil {
-			return err
+			return fmt.Errorf("error creating tracing interceptor: %w", err)
 		}
-		return WithMetrics(metrics)(o)
+
+		return WithInterceptors(tracing)(o)
 	}
 }
 
+// WithPrometheusMetrics creates a Prometheus handler, as NewPrometheusHandler,
+// and returns the option to report the client metrics to it. Close the
+// returned closer on shutdown to flush the metrics and stop the listener.
+func WithPrometheusMetrics(
+	listenAddress, prefix string,
+	registry *prom.Registry,
+	opts ...PrometheusOption,
+) (Options, io.Closer, error) {
+	metrics, closer, err := NewPrometheusHandler(listenAddress, prefix, registry, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return WithMetrics(metrics), closer, nil
+}
+
+// WithTLS enables TLS and applies the options to the TLS config. If TLS is
+// already enabled, the options change the existing config.
 func WithTLS(enabled bool, tlsOpts ...TLSOptions) Options {
 	return func(o *client.Options) error {
-		if enabled {
-			tlsConfig := new(tls.Config)
+		if !enabled {
+			return nil
+		}
 
-			for _, opt := range tlsOpts {
-				if err := opt(tlsConfig); err != nil {
-					return fmt.Errorf("error configuring tls options: %w", err)
-				}
-			}
+		if o.ConnectionOptions.TLS == nil {
+			o.ConnectionOptions.TLS = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
 
-			connectionOpts := &client.ConnectionOptions{
-				TLS: tlsConfig,
+		for _, opt := range tlsOpts {
+			if err := opt(o.ConnectionOptions.TLS); err != nil {
+				return fmt.Errorf("error configuring tls options: %w", err)
 			}
-			return WithConnectionOptions(connectionOpts)(o)
 		}
 		return nil
 	}
 }
 
-func WithZerolog(logger *zerolog.Logger) Options {
-	return WithLogger(NewZerologHandler(logger))
+func WithSlog(l *slog.Logger) Options {
+	return WithLogger(NewSlogHandler(l))
+}
+
+func WithZerolog(l *zerolog.Logger) Options {
+	return WithLogger(NewZerologHandler(l))
 }
 
 // TLS options
@@ -0,0 +1,224 @@
+/*
+ * Copyright 2023 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package temporal
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/client"
+	"google.golang.org/grpc"
+)
+
+func applyOptions(opts ...Options) (*client.Options, error) {
+	o := &client.Options{}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+	return o, nil
+}
+
+func TestConnectionOptionsCompose(t *testing.T) {
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "client.pem")
+	keyPath := filepath.Join(dir, "client.key")
+	writeTestCert(t, certPath, keyPath, "client")
+
+	o, err := applyOptions(
+		WithKeepAlive(time.Second*10, time.Second*5),
+		WithDialOptions(grpc.WithUserAgent("test")),
+		WithGRPCMetadata(map[string]string{"tenant": "a"}),
+		WithTLS(true, WithTLSServerName("temporal.example.com")),
+		WithMTLS(certPath, keyPath),
+		WithConnectionOptions(&client.ConnectionOptions{
+			Authority:   "temporal",
+			DialOptions: []grpc.DialOption{grpc.WithUserAgent("test")},
+		}),
+		WithGRPCMetadata(map[string]string{"tenant": "a", "region": "eu"}),
+	)
+	require.NoError(t, err)
+
+	// Nothing set earlier is lost
+	assert.Equal(t, time.Second*10, o.ConnectionOptions.KeepAliveTime)
+	assert.Equal(t, "temporal", o.ConnectionOptions.Authority)
+	assert.Len(t, o.ConnectionOptions.DialOptions, 2)
+	require.NotNil(t, o.ConnectionOptions.TLS)
+	assert.Equal(t, "temporal.example.com", o.ConnectionOptions.TLS.ServerName)
+	assert.NotNil(t, o.ConnectionOptions.TLS.GetClientCertificate)
+
+	headers, err := o.HeadersProvider.GetHeaders(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"tenant": "a", "region": "eu"}, headers)
+}
+
+func TestConnectionOptionsConflicts(t *testing.T) {
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "client.pem")
+	keyPath := filepath.Join(dir, "client.key")
+	writeTestCert(t, certPath, keyPath, "client")
+
+	tests := []struct {
+		Name    string
+		Options []Options
+	}{
+		{
+			Name: "keepalive",
+			Options: []Options{
+				WithKeepAlive(time.Second, time.Second),
+				WithKeepAlive(time.Minute, time.Second),
+			},
+		},
+		{
+			Name: "tls config",
+			Options: []Options{
+				WithTLS(true),
+				WithConnectionOptions(&client.ConnectionOptions{TLS: &tls.Config{MinVersion: tls.VersionTLS13}}),
+			},
+		},
+		{
+			Name: "grpc metadata",
+			Options: []Options{
+				WithGRPCMetadata(map[string]string{"tenant": "a"}),
+				WithGRPCMetadata(map[string]string{"tenant": "b"}),
+			},
+		},
+		{
+			Name: "credentials",
+			Options: []Options{
+				WithAPICredentials("api-key-1"),
+				WithAPICredentials("api-key-2"),
+			},
+		},
+		{
+			Name: "client certificate",
+			Options: []Options{
+				WithMTLS(certPath, keyPath),
+				WithMTLS(certPath, keyPath),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			_, err := applyOptions(test.Options...)
+			assert.Error(t, err)
+		})
+	}
+}
+
+type tenantKey struct{}
+
+func TestWithHeaders(t *testing.T) {
+	o, err := applyOptions(
+		WithGRPCMetadata(map[string]string{"region": "eu"}),
+		WithHeaders(map[string]string{"tenant": "default"}, HeadersFunc(func(ctx context.Context) (map[string]string, error) {
+			tenant, ok := ctx.Value(tenantKey{}).(string)
+			if !ok {
+				return nil, nil
+			}
+			return map[string]string{"tenant": tenant}, nil
+		})),
+	)
+	require.NoError(t, err)
+
+	headers, err := o.HeadersProvider.GetHeaders(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"region": "eu", "tenant": "default"}, headers)
+
+	headers, err = o.HeadersProvider.GetHeaders(context.WithValue(context.Background(), tenantKey{}, "acme"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"region": "eu", "tenant": "acme"}, headers)
+}
+
+func TestWithIdentity(t *testing.T) {
+	o, err := applyOptions(WithIdentity(""))
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(o.Identity, fmt.Sprintf("%d@", os.Getpid())))
+
+	o, err = applyOptions(WithIdentity("worker-1"))
+	require.NoError(t, err)
+	assert.Equal(t, "worker-1", o.Identity)
+}
+
+func TestWithHostPortResolver(t *testing.T) {
+	o, err := applyOptions(WithHostPortResolver(func(context.Context) ([]string, error) {
+		return []string{"10.0.0.1:7233", "10.0.0.2:7233"}, nil
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, "temporal-endpoints:///temporal", o.HostPort)
+	assert.Len(t, o.ConnectionOptions.DialOptions, 1)
+}
+
+func TestWithHostPortResolverDialContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	connector, err := NewConnector(WithDialContext(ctx))
+	require.NoError(t, err)
+
+	// The endpoints are resolved within the dial, so the context stops it
+	start := time.Now()
+	_, err = connector.Connect(WithHostPortResolver(func(ctx context.Context) ([]string, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}))
+	require.Error(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestNewConnectionWithEnvvarsOverrides(t *testing.T) {
+	t.Setenv("TEMPORAL_CONFIG_FILE", filepath.Join(t.TempDir(), "missing.toml"))
+	t.Setenv("TEMPORAL_ADDRESS", "env:7233")
+	t.Setenv("TEMPORAL_API_KEY", "env-key")
+	t.Setenv("TEMPORAL_GRPC_META_TENANT", "env")
+	t.Setenv("TEMPORAL_GRPC_META_REGION", "eu")
+
+	// Stop before dialling, so the options can be checked
+	errStop := errors.New("stop")
+	var o *client.Options
+
+	_, err := NewConnectionWithEnvvars(append(
+		ParseCobraOpts(&TemporalOpts{Address: "flag:7233", APIKey: "flag-key"}),
+		WithGRPCMetadata(map[string]string{"tenant": "flag"}),
+		WithHeaders(nil, HeadersFunc(func(context.Context) (map[string]string, error) {
+			return map[string]string{"request": "1"}, nil
+		})),
+		func(opts *client.Options) error {
+			o = opts
+			return errStop
+		},
+	)...)
+	require.ErrorIs(t, err, errStop)
+
+	assert.Equal(t, "flag:7233", o.HostPort)
+	assert.NotNil(t, o.Credentials)
+
+	headers, err := o.HeadersProvider.GetHeaders(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"tenant": "flag", "region": "eu", "request": "1"}, headers)
+}
@@ -0,0 +1,172 @@
+/*
+ * Copyright 2023 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package temporal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.temporal.io/api/serviceerror"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultDialRetryInterval    = 500 * time.Millisecond
+	defaultDialRetryMaxInterval = 10 * time.Second
+)
+
+// Connector creates Temporal clients. It controls how they connect, which
+// isn't part of client.Options.
+type Connector struct {
+	ctx         context.Context
+	lazy        bool
+	retry       bool
+	interval    time.Duration
+	maxInterval time.Duration
+	maxWait     time.Duration
+}
+
+type ConnectorOption func(*Connector)
+
+// NewConnector creates a Connector with the dial options. NewConnection uses
+// one without any.
+func NewConnector(opts ...ConnectorOption) (*Connector, error) {
+	c := &Connector{}
+	for _, o := range opts {
+		o(c)
+	}
+
+	if c.lazy {
+		if c.retry {
+			return nil, errors.New("lazy connections cannot be retried")
+		}
+		if c.ctx != nil {
+			return nil, errors.New("lazy connections don't dial, so cannot use a dial context")
+		}
+	}
+
+	return c, nil
+}
+
+// Connect creates a Temporal client with only the options supplied
+func (c *Connector) Connect(options ...Options) (client.Client, error) {
+	return newConnection(c, &client.Options{}, options...)
+}
+
+// ConnectWithEnvvars creates a Temporal client, with the Temporal environment
+// config loader as the starting point
+func (c *Connector) ConnectWithEnvvars(options ...Options) (client.Client, error) {
+	return newConnectionWithEnvvars(c, options...)
+}
+
+// WithDialContext connects with the context, so it can be cancelled or
+// given a deadline. This includes any time spent waiting to retry.
+func WithDialContext(ctx context.Context) ConnectorOption {
+	return func(c *Connector) {
+		c.ctx = ctx
+	}
+}
+
+// WithDialRetry retries connecting with an exponential backoff, for when the
+// Temporal server may not have started yet. Only errors saying the server is
+// unavailable or timed out are retried. It gives up once maxWait has passed.
+// The wait starts at 500ms and doubles up to 10s.
+func WithDialRetry(maxWait time.Duration) ConnectorOption {
+	return WithDialRetryBackoff(defaultDialRetryInterval, defaultDialRetryMaxInterval, maxWait)
+}
+
+// WithDialRetryBackoff is WithDialRetry with the backoff intervals set
+func WithDialRetryBackoff(interval, maxInterval, maxWait time.Duration) ConnectorOption {
+	return func(c *Connector) {
+		c.retry = true
+		c.interval = interval
+		c.maxInterval = max(interval, maxInterval)
+		c.maxWait = maxWait
+	}
+}
+
+// WithLazyConnection doesn't connect until the client is first used, so the
+// application can start without the Temporal server. This can't be used with
+// WithDialRetry or WithDialContext.
+func WithLazyConnection() ConnectorOption {
+	return func(c *Connector) {
+		c.lazy = true
+	}
+}
+
+// retryable is true for errors that may go away once the server is up,
+// rather than ones such as bad credentials that fail every time
+func retryable(err error) bool {
+	var unavailable *serviceerror.Unavailable
+	var deadlineExceeded *serviceerror.DeadlineExceeded
+	if errors.As(err, &unavailable) || errors.As(err, &deadlineExceeded) {
+		return true
+	}
+
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *Connector) dial(opts client.Options) (client.Client, error) {
+	l := log.With(opts.Logger, "hostPort", opts.HostPort, "namespace", opts.Namespace)
+
+	if c.lazy {
+		l.Debug("Creating lazy Temporal client")
+		return client.NewLazyClient(opts)
+	}
+
+	ctx := c.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	start := time.Now()
+	wait := c.interval
+	for attempt := 1; ; attempt++ {
+		l.Debug("Connecting to Temporal", "attempt", attempt)
+
+		temporalClient, err := client.DialContext(ctx, opts)
+		if err == nil {
+			l.Debug("Connected to Temporal", "attempt", attempt)
+			return temporalClient, nil
+		}
+
+		if !c.retry || !retryable(err) || ctx.Err() != nil || time.Since(start)+wait > c.maxWait {
+			l.Error("Unable to connect to Temporal", "attempt", attempt, "error", err)
+			return nil, fmt.Errorf("error connecting to temporal: %w", err)
+		}
+
+		l.Warn("Unable to connect to Temporal, retrying", "attempt", attempt, "retryIn", wait, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("error connecting to temporal: %w", ctx.Err())
+		case <-time.After(wait):
+		}
+
+		wait = min(wait*2, c.maxInterval)
+	}
+}
@@ -0,0 +1,152 @@
+/*
+ * Copyright 2023 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package temporal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/api/serviceerror"
+	"go.temporal.io/sdk/client"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// closedAddress is an address with nothing listening on it
+func closedAddress(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+	return addr
+}
+
+// connect creates a Connector and connects with it
+func connect(t *testing.T, connectorOpts []ConnectorOption, options ...Options) (client.Client, error) {
+	t.Helper()
+
+	connector, err := NewConnector(connectorOpts...)
+	require.NoError(t, err)
+	return connector.Connect(options...)
+}
+
+func TestConnectorDialRetry(t *testing.T) {
+	var out bytes.Buffer
+	l := slog.New(slog.NewJSONHandler(&out, nil))
+
+	_, err := connect(t,
+		[]ConnectorOption{WithDialRetryBackoff(10*time.Millisecond, 20*time.Millisecond, 200*time.Millisecond)},
+		WithHostPort(closedAddress(t)),
+		WithSlog(l),
+	)
+	require.Error(t, err)
+
+	assert.Greater(t, strings.Count(out.String(), "Unable to connect to Temporal, retrying"), 1)
+	assert.Contains(t, out.String(), `"attempt":`)
+}
+
+func TestConnectorDialContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := connect(t,
+		[]ConnectorOption{WithDialContext(ctx), WithDialRetry(time.Minute)},
+		WithHostPort(closedAddress(t)),
+	)
+	require.Error(t, err)
+	assert.Less(t, time.Since(start), 10*time.Second)
+}
+
+func TestConnectorLazy(t *testing.T) {
+	c, err := connect(t,
+		[]ConnectorOption{WithLazyConnection()},
+		WithHostPort(closedAddress(t)),
+	)
+	require.NoError(t, err)
+	c.Close()
+}
+
+func TestNewConnectorErrors(t *testing.T) {
+	tests := []struct {
+		Name    string
+		Options []ConnectorOption
+	}{
+		{
+			Name:    "lazy with retry",
+			Options: []ConnectorOption{WithLazyConnection(), WithDialRetry(time.Second)},
+		},
+		{
+			Name:    "lazy with context",
+			Options: []ConnectorOption{WithLazyConnection(), WithDialContext(context.Background())},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			_, err := NewConnector(test.Options...)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		Name      string
+		Err       error
+		Retryable bool
+	}{
+		{
+			Name:      "unavailable",
+			Err:       fmt.Errorf("failed reaching server: %w", serviceerror.NewUnavailable("down")),
+			Retryable: true,
+		},
+		{
+			Name:      "deadline exceeded",
+			Err:       fmt.Errorf("failed reaching server: %w", serviceerror.NewDeadlineExceeded("slow")),
+			Retryable: true,
+		},
+		{
+			Name:      "grpc unavailable",
+			Err:       status.Error(codes.Unavailable, "down"),
+			Retryable: true,
+		},
+		{
+			Name: "unauthenticated",
+			Err:  fmt.Errorf("failed reaching server: %w", serviceerror.NewPermissionDenied("bad key", "")),
+		},
+		{
+			Name: "other",
+			Err:  errors.New("boom"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			assert.Equal(t, test.Retryable, retryable(test.Err))
+		})
+	}
+}
@@ -0,0 +1,224 @@
+/*
+ * Copyright 2023 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package temporal
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+
+	commonpb "go.temporal.io/api/common/v1"
+	"go.temporal.io/sdk/converter"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// MetadataEncodingEncrypted is the encoding of encrypted payloads
+	MetadataEncodingEncrypted = "binary/encrypted"
+	// MetadataEncryptionKeyID is the ID of the key that encrypted the payload
+	MetadataEncryptionKeyID = "encryption-key-id"
+
+	encryptionKeyLength = 32
+)
+
+// EncryptionKey is an AES-256 key. The ID is stored with each payload, so it
+// must never be reused for a different key.
+type EncryptionKey struct {
+	ID  string
+	Key []byte
+}
+
+// EncryptionCodec encrypts payloads with AES-256-GCM. Payloads are encrypted
+// with the last key and can be decrypted with any of them, so keys can be
+// rotated by adding a new key to the end.
+type EncryptionCodec struct {
+	keys   map[string]cipher.AEAD
+	active string
+}
+
+// NewEncryptionCodec creates the codec from the keys, newest last
+func NewEncryptionCodec(keys ...EncryptionKey) (*EncryptionCodec, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("at least one encryption key required")
+	}
+
+	c := &EncryptionCodec{
+		keys: make(map[string]cipher.AEAD, len(keys)),
+	}
+
+	for _, k := range keys {
+		if k.ID == "" {
+			return nil, errors.New("encryption key id required")
+		}
+		if _, ok := c.keys[k.ID]; ok {
+			return nil, fmt.Errorf("duplicate encryption key id: %s", k.ID)
+		}
+		if len(k.Key) != encryptionKeyLength {
+			return nil, fmt.Errorf("encryption key %s must be %d bytes", k.ID, encryptionKeyLength)
+		}
+
+		block, err := aes.NewCipher(k.Key)
+		if err != nil {
+			return nil, fmt.Errorf("error creating cipher for key %s: %w", k.ID, err)
+		}
+		gcm, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("error creating gcm for key %s: %w", k.ID, err)
+		}
+
+		c.keys[k.ID] = gcm
+		c.active = k.ID
+	}
+
+	return c, nil
+}
+
+// NewEncryptionDataConverter wraps the default data converter with the
+// encryption codec. Use it with WithDataAndFailureConverter so failure
+// messages are encrypted too.
+func NewEncryptionDataConverter(keys ...EncryptionKey) (converter.DataConverter, error) {
+	codec, err := NewEncryptionCodec(keys...)
+	if err != nil {
+		return nil, err
+	}
+	return NewCodecDataConverter(codec), nil
+}
+
+// NewCodecDataConverter wraps the default data converter with the codecs.
+// Codecs encode in reverse order, so the first codec is the last to see the
+// payload on encoding - put encryption first and compression after it.
+func NewCodecDataConverter(codecs ...converter.PayloadCodec) converter.DataConverter {
+	return converter.NewCodecDataConverter(converter.GetDefaultDataConverter(), codecs...)
+}
+
+// Encode encrypts each payload with the newest key
+func (c *EncryptionCodec) Encode(payloads []*commonpb.Payload) ([]*commonpb.Payload, error) {
+	gcm := c.keys[c.active]
+
+	result := make([]*commonpb.Payload, len(payloads))
+	for i, p := range payloads {
+		data, err := proto.Marshal(p)
+		if err != nil {
+			return nil, fmt.Errorf("error marshalling payload: %w", err)
+		}
+
+		nonce := make([]byte, gcm.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, fmt.Errorf("error generating nonce: %w", err)
+		}
+
+		result[i] = &commonpb.Payload{
+			Metadata: map[string][]byte{
+				converter.MetadataEncoding: []byte(MetadataEncodingEncrypted),
+				MetadataEncryptionKeyID:    []byte(c.active),
+			},
+			// The nonce is prefixed so it's available for decrypting
+			Data: gcm.Seal(nonce, nonce, data, nil),
+		}
+	}
+
+	return result, nil
+}
+
+// Decode decrypts each encrypted payload with the key it was encrypted with.
+// Other payloads are returned unchanged.
+func (c *EncryptionCodec) Decode(payloads []*commonpb.Payload) ([]*commonpb.Payload, error) {
+	result := make([]*commonpb.Payload, len(payloads))
+	for i, p := range payloads {
+		if string(p.GetMetadata()[converter.MetadataEncoding]) != MetadataEncodingEncrypted {
+			result[i] = p
+			continue
+		}
+
+		keyID := string(p.GetMetadata()[MetadataEncryptionKeyID])
+		gcm, ok := c.keys[keyID]
+		if !ok {
+			return nil, fmt.Errorf("unknown encryption key id: %s", keyID)
+		}
+
+		if len(p.GetData()) < gcm.NonceSize() {
+			return nil, errors.New("encrypted payload too short")
+		}
+		nonce, ciphertext := p.GetData()[:gcm.NonceSize()], p.GetData()[gcm.NonceSize():]
+
+		data, err := gcm.Open(nil, nonce, ciphertext, nil)
+		if err != nil {
+			return nil, fmt.Errorf("error decrypting payload with key %s: %w", keyID, err)
+		}
+
+		result[i] = &commonpb.Payload{}
+		if err := proto.Unmarshal(data, result[i]); err != nil {
+			return nil, fmt.Errorf("error unmarshalling payload: %w", err)
+		}
+	}
+
+	return result, nil
+}
+
+// LoadEncryptionKeyFile loads a key from a file. The file can contain the raw
+// 32 bytes, or the key encoded as base64 or hex.
+func LoadEncryptionKeyFile(id, path string) (EncryptionKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return EncryptionKey{}, fmt.Errorf("error reading encryption key file: %w", err)
+	}
+
+	key, err := parseEncryptionKey(data)
+	if err != nil {
+		return EncryptionKey{}, fmt.Errorf("error parsing encryption key file %s: %w", path, err)
+	}
+
+	return EncryptionKey{ID: id, Key: key}, nil
+}
+
+// LoadEncryptionKeyEnv loads a key encoded as base64 or hex from an
+// environment variable
+func LoadEncryptionKeyEnv(id, name string) (EncryptionKey, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return EncryptionKey{}, fmt.Errorf("encryption key environment variable not set: %s", name)
+	}
+
+	key, err := parseEncryptionKey([]byte(value))
+	if err != nil {
+		return EncryptionKey{}, fmt.Errorf("error parsing encryption key environment variable %s: %w", name, err)
+	}
+
+	return EncryptionKey{ID: id, Key: key}, nil
+}
+
+func parseEncryptionKey(data []byte) ([]byte, error) {
+	if len(data) == encryptionKeyLength {
+		return data, nil
+	}
+
+	text := string(bytes.TrimSpace(data))
+	if key, err := hex.DecodeString(text); err == nil && len(key) == encryptionKeyLength {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(text); err == nil && len(key) == encryptionKeyLength {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("key must be %d bytes, or encoded as base64 or hex", encryptionKeyLength)
+}
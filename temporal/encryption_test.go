@@ -0,0 +1,131 @@
+/*
+ * Copyright 2023 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package temporal
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/converter"
+)
+
+func TestEncryptionCodec(t *testing.T) {
+	oldKey := EncryptionKey{ID: "old", Key: bytes.Repeat([]byte{1}, 32)}
+	newKey := EncryptionKey{ID: "new", Key: bytes.Repeat([]byte{2}, 32)}
+
+	oldConverter, err := NewEncryptionDataConverter(oldKey)
+	require.NoError(t, err)
+
+	rotatedConverter, err := NewEncryptionDataConverter(oldKey, newKey)
+	require.NoError(t, err)
+
+	oldPayload, err := oldConverter.ToPayload("secret value")
+	require.NoError(t, err)
+	assert.Equal(t, "old", string(oldPayload.Metadata[MetadataEncryptionKeyID]))
+	assert.NotContains(t, string(oldPayload.Data), "secret value")
+
+	// Encrypted with the newest key
+	newPayload, err := rotatedConverter.ToPayload("secret value")
+	require.NoError(t, err)
+	assert.Equal(t, "new", string(newPayload.Metadata[MetadataEncryptionKeyID]))
+
+	// Decrypted with any key
+	var value string
+	require.NoError(t, rotatedConverter.FromPayload(oldPayload, &value))
+	assert.Equal(t, "secret value", value)
+
+	// The old key doesn't know the new one
+	assert.Error(t, oldConverter.FromPayload(newPayload, &value))
+
+	// Unencrypted payloads are passed through
+	plain, err := converter.GetDefaultDataConverter().ToPayload("plain value")
+	require.NoError(t, err)
+	require.NoError(t, rotatedConverter.FromPayload(plain, &value))
+	assert.Equal(t, "plain value", value)
+}
+
+func TestNewEncryptionCodecErrors(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+
+	tests := []struct {
+		Name string
+		Keys []EncryptionKey
+	}{
+		{
+			Name: "no keys",
+		},
+		{
+			Name: "no id",
+			Keys: []EncryptionKey{{Key: key}},
+		},
+		{
+			Name: "short key",
+			Keys: []EncryptionKey{{ID: "key", Key: key[:16]}},
+		},
+		{
+			Name: "duplicate id",
+			Keys: []EncryptionKey{{ID: "key", Key: key}, {ID: "key", Key: key}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			_, err := NewEncryptionCodec(test.Keys...)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestLoadEncryptionKey(t *testing.T) {
+	key := bytes.Repeat([]byte{3}, 32)
+	dir := t.TempDir()
+
+	files := map[string][]byte{
+		"raw":    key,
+		"base64": []byte(base64.StdEncoding.EncodeToString(key) + "\n"),
+		"hex":    []byte(hex.EncodeToString(key)),
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, data, 0o600))
+
+		k, err := LoadEncryptionKeyFile(name, path)
+		require.NoError(t, err, name)
+		assert.Equal(t, EncryptionKey{ID: name, Key: key}, k)
+	}
+
+	_, err := LoadEncryptionKeyFile("missing", filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+
+	t.Setenv("TEST_ENCRYPTION_KEY", base64.StdEncoding.EncodeToString(key))
+	k, err := LoadEncryptionKeyEnv("env", "TEST_ENCRYPTION_KEY")
+	require.NoError(t, err)
+	assert.Equal(t, key, k.Key)
+
+	t.Setenv("TEST_ENCRYPTION_KEY", "too-short")
+	_, err = LoadEncryptionKeyEnv("env", "TEST_ENCRYPTION_KEY")
+	assert.Error(t, err)
+
+	_, err = LoadEncryptionKeyEnv("env", "TEST_ENCRYPTION_KEY_UNSET")
+	assert.Error(t, err)
+}
@@ -18,31 +18,75 @@ package temporal
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
-	"errors"
+	"fmt"
 	"net/http"
+	"slices"
 	"time"
 
-	"github.com/rs/zerolog/log"
+	"github.com/mrsimonemms/golang-helpers/logger"
 	enumspb "go.temporal.io/api/enums/v1"
+	taskqueuepb "go.temporal.io/api/taskqueue/v1"
+	"go.temporal.io/api/workflowservice/v1"
 	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/worker"
 )
 
 type healthcheck struct {
-	client     client.Client
-	taskQueues []string
-	timeout    time.Duration
+	client         client.Client
+	taskQueues     []string
+	timeout        time.Duration
+	namespace      string
+	pollerIdentity string
+	pollerRecency  time.Duration
+	requirePollers bool
+	livenessPaths  []string
+	readinessPaths []string
+	startupPaths   []string
+	tlsConfig      *tls.Config
+	tlsCertFile    string
+	tlsKeyFile     string
+	concurrency    int
+	custom         customChecks
+	cache          readinessCache
+	workers        workerStates
+
+	deployment         *worker.WorkerDeploymentVersion
+	deploymentStatuses []DeploymentStatus
 }
 
+type HealthCheckOption func(*healthcheck)
+
 type liveResponse struct {
-	Healthy bool   `json:"healthy"`
-	Error   string `json:"error,omitempty"`
+	Healthy bool                `json:"healthy"`
+	Error   string              `json:"error,omitempty"`
+	Checks  []healthCheckResult `json:"checks,omitempty"`
+	Workers []workerHealth      `json:"workers,omitempty"`
+}
+
+type pollerHealth struct {
+	Identity       string    `json:"identity"`
+	LastAccessTime time.Time `json:"lastAccessTime"`
+	RatePerSecond  float64   `json:"ratePerSecond"`
+}
+
+type backlogHealth struct {
+	ApproximateCount  int64   `json:"approximateCount"`
+	ApproximateAge    string  `json:"approximateAge"`
+	TasksAddRate      float32 `json:"tasksAddRate"`
+	TasksDispatchRate float32 `json:"tasksDispatchRate"`
 }
 
 type taskQueueTypeHealth struct {
-	Type    string `json:"type"`
-	Healthy bool   `json:"healthy"`
-	Error   string `json:"error,omitempty"`
+	Type           string         `json:"type"`
+	Healthy        bool           `json:"healthy"`
+	Error          string         `json:"error,omitempty"`
+	PollerCount    int            `json:"pollerCount"`
+	LocalPoller    bool           `json:"localPoller,omitempty"`
+	LastAccessTime *time.Time     `json:"lastAccessTime,omitempty"`
+	Pollers        []pollerHealth `json:"pollers,omitempty"`
+	Backlog        *backlogHealth `json:"backlog,omitempty"`
 }
 
 type taskQueueHealth struct {
@@ -52,10 +96,15 @@ type taskQueueHealth struct {
 }
 
 type readyResponse struct {
-	Healthy    bool              `json:"healthy"`
-	TemporalOK bool              `json:"temporalOk"`
-	Error      string            `json:"error,omitempty"`
-	TaskQueues []taskQueueHealth `json:"taskQueues,omitempty"`
+	Healthy    bool                `json:"healthy"`
+	TemporalOK bool                `json:"temporalOk"`
+	Error      string              `json:"error,omitempty"`
+	TaskQueues []taskQueueHealth   `json:"taskQueues,omitempty"`
+	Checks     []healthCheckResult `json:"checks,omitempty"`
+	Workers    []workerHealth      `json:"workers,omitempty"`
+	Deployment *deploymentHealth   `json:"deployment,omitempty"`
+	CheckedAt  time.Time           `json:"checkedAt"`
+	Age        string              `json:"age"`
 }
 
 func writeJSON(w http.ResponseWriter, statusCode int, body any) {
@@ -80,18 +129,69 @@ func (h *healthcheck) checkTemporal(ctx context.Context) error {
 	return err
 }
 
+// WithHealthNamespace sets the namespace of the task queues, which must be
+// the client's. This is needed to report the backlog, as the client doesn't
+// expose its namespace. Without it, the backlog is left out.
+func WithHealthNamespace(namespace string) HealthCheckOption {
+	return func(h *healthcheck) {
+		h.namespace = namespace
+	}
+}
+
+// WithHealthPollerIdentity only treats a task queue as ready if this worker
+// identity is polling it, rather than any recent poller
+func WithHealthPollerIdentity(identity string) HealthCheckOption {
+	return func(h *healthcheck) {
+		h.pollerIdentity = identity
+	}
+}
+
+// WithHealthPollerRecency sets how recently a poller must have been seen to
+// count. Defaults to 2 minutes.
+func WithHealthPollerRecency(window time.Duration) HealthCheckOption {
+	return func(h *healthcheck) {
+		h.pollerRecency = window
+	}
+}
+
+// WithHealthRequirePollers sets whether a task queue needs a poller to be
+// ready. Defaults to true. If false, it only needs to exist.
+func WithHealthRequirePollers(require bool) HealthCheckOption {
+	return func(h *healthcheck) {
+		h.requirePollers = require
+	}
+}
+
+func (h *healthcheck) describeTaskQueue(
+	ctx context.Context,
+	taskQueue string,
+	taskQueueType enumspb.TaskQueueType,
+) (*workflowservice.DescribeTaskQueueResponse, error) {
+	if h.namespace == "" {
+		return h.client.DescribeTaskQueue(ctx, taskQueue, taskQueueType)
+	}
+
+	return h.client.WorkflowService().DescribeTaskQueue(ctx, &workflowservice.DescribeTaskQueueRequest{
+		Namespace:     h.namespace,
+		TaskQueue:     &taskqueuepb.TaskQueue{Name: taskQueue, Kind: enumspb.TASK_QUEUE_KIND_NORMAL},
+		TaskQueueType: taskQueueType,
+		ReportStats:   true,
+	})
+}
+
 func (h *healthcheck) checkTaskQueue(
 	ctx context.Context,
 	taskQueue string,
 	taskQueueType enumspb.TaskQueueType,
 ) taskQueueTypeHealth {
-	_, err := h.client.DescribeTaskQueue(ctx, taskQueue, taskQueueType)
+	l := logger.Default().With(
+		"taskQueue", taskQueue,
+		"taskQueueType", taskQueueTypeName(taskQueueType),
+	)
+
+	resp, err := h.describeTaskQueue(ctx, taskQueue, taskQueueType)
 	if err != nil {
-		log.Error().
-			Err(err).
-			Str("taskQueue", taskQueue).
-			Str("taskQueueType", taskQueueTypeName(taskQueueType)).
-			Msg("Temporal task queue unhealthy")
+		l.Error("Temporal task queue unhealthy", "error", err)
 
 		return taskQueueTypeHealth{
 			Type:    taskQueueTypeName(taskQueueType),
@@ -100,76 +200,148 @@ func (h *healthcheck) checkTaskQueue(
 		}
 	}
 
-	log.Debug().
-		Str("taskQueue", taskQueue).
-		Str("taskQueueType", taskQueueTypeName(taskQueueType)).
-		Msg("Temporal task queue healthy")
+	result := h.checkPollers(resp.GetPollers())
+	result.Type = taskQueueTypeName(taskQueueType)
 
-	return taskQueueTypeHealth{
-		Type:    taskQueueTypeName(taskQueueType),
-		Healthy: true,
+	if stats := resp.GetStats(); stats != nil {
+		result.Backlog = &backlogHealth{
+			ApproximateCount:  stats.GetApproximateBacklogCount(),
+			ApproximateAge:    stats.GetApproximateBacklogAge().AsDuration().String(),
+			TasksAddRate:      stats.GetTasksAddRate(),
+			TasksDispatchRate: stats.GetTasksDispatchRate(),
+		}
 	}
+
+	if !result.Healthy {
+		l.Error("Temporal task queue has no active pollers", "error", result.Error)
+		return result
+	}
+
+	l.Debug("Temporal task queue healthy", "pollerCount", result.PollerCount)
+
+	return result
 }
 
-func (h *healthcheck) serveLiveness(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(r.Context(), h.timeout)
-	defer cancel()
+// checkPollers looks for the local worker, or any poller seen recently
+func (h *healthcheck) checkPollers(pollers []*taskqueuepb.PollerInfo) taskQueueTypeHealth {
+	result := taskQueueTypeHealth{
+		PollerCount: len(pollers),
+		Pollers:     make([]pollerHealth, 0, len(pollers)),
+	}
 
-	if err := h.checkTemporal(ctx); err != nil {
-		log.Error().Err(err).Msg("Temporal liveness check failed")
-		writeJSON(w, http.StatusServiceUnavailable, liveResponse{
-			Healthy: false,
-			Error:   err.Error(),
+	recent := false
+	for _, p := range pollers {
+		lastAccess := p.GetLastAccessTime().AsTime()
+
+		result.Pollers = append(result.Pollers, pollerHealth{
+			Identity:       p.GetIdentity(),
+			LastAccessTime: lastAccess,
+			RatePerSecond:  p.GetRatePerSecond(),
 		})
-		return
+
+		if result.LastAccessTime == nil || lastAccess.After(*result.LastAccessTime) {
+			result.LastAccessTime = &lastAccess
+		}
+
+		isRecent := time.Since(lastAccess) <= h.pollerRecency
+		if h.pollerIdentity != "" && p.GetIdentity() == h.pollerIdentity && isRecent {
+			result.LocalPoller = true
+		}
+		recent = recent || isRecent
 	}
 
-	writeJSON(w, http.StatusOK, liveResponse{
-		Healthy: true,
-	})
+	switch {
+	case !h.requirePollers:
+		result.Healthy = true
+	case h.pollerIdentity != "":
+		result.Healthy = result.LocalPoller
+		if !result.Healthy {
+			result.Error = fmt.Sprintf("worker %q is not polling", h.pollerIdentity)
+		}
+	default:
+		result.Healthy = recent
+		if !result.Healthy {
+			result.Error = fmt.Sprintf("no pollers seen in the last %s", h.pollerRecency)
+		}
+	}
+
+	return result
 }
 
-func (h *healthcheck) serveReadiness(w http.ResponseWriter, r *http.Request) {
+// startCustomChecks runs the custom checks in the background, so they don't
+// wait for the Temporal checks
+func (h *healthcheck) startCustomChecks(
+	ctx context.Context,
+	kind HealthCheckKind,
+) func() ([]healthCheckResult, bool) {
+	var results []healthCheckResult
+	var healthy bool
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		results, healthy = h.runCustomChecks(ctx, kind)
+	}()
+
+	return func() ([]healthCheckResult, bool) {
+		<-done
+		return results, healthy
+	}
+}
+
+func (h *healthcheck) serveLiveness(w http.ResponseWriter, r *http.Request) {
+	waitForChecks := h.startCustomChecks(r.Context(), HealthCheckLiveness)
+
 	ctx, cancel := context.WithTimeout(r.Context(), h.timeout)
 	defer cancel()
 
-	resp := readyResponse{
-		Healthy:    true,
-		TemporalOK: true,
-		TaskQueues: make([]taskQueueHealth, 0, len(h.taskQueues)),
+	resp := liveResponse{
+		Healthy: true,
 	}
 
 	if err := h.checkTemporal(ctx); err != nil {
-		log.Error().Err(err).Msg("Temporal readiness health check failed")
+		logger.Default().Error("Temporal liveness check failed", "error", err)
 		resp.Healthy = false
-		resp.TemporalOK = false
 		resp.Error = err.Error()
+	}
+
+	workers, workersHealthy := h.workers.live()
+	resp.Workers = workers
+
+	checks, checksHealthy := waitForChecks()
+	resp.Checks = checks
+	resp.Healthy = resp.Healthy && checksHealthy && workersHealthy
 
-		writeJSON(w, http.StatusServiceUnavailable, resp)
-		return
+	statusCode := http.StatusOK
+	if !resp.Healthy {
+		statusCode = http.StatusServiceUnavailable
 	}
 
-	for _, tq := range h.taskQueues {
-		checks := []taskQueueTypeHealth{
-			h.checkTaskQueue(ctx, tq, enumspb.TASK_QUEUE_TYPE_WORKFLOW),
-			h.checkTaskQueue(ctx, tq, enumspb.TASK_QUEUE_TYPE_ACTIVITY),
-		}
+	writeJSON(w, statusCode, resp)
+}
 
-		taskQueueHealthy := true
-		for _, check := range checks {
-			if !check.Healthy {
-				taskQueueHealthy = false
-				resp.Healthy = false
-			}
-		}
+func (h *healthcheck) serveReadiness(w http.ResponseWriter, r *http.Request) {
+	waitForChecks := h.startCustomChecks(r.Context(), HealthCheckReadiness)
 
-		resp.TaskQueues = append(resp.TaskQueues, taskQueueHealth{
-			TaskQueue: tq,
-			Healthy:   taskQueueHealthy,
-			Checks:    checks,
-		})
+	snapshot := h.readiness(r.Context())
+
+	resp := readyResponse{
+		Healthy:    snapshot.healthy,
+		TemporalOK: snapshot.temporalOK,
+		Error:      snapshot.err,
+		TaskQueues: snapshot.taskQueues,
+		Deployment: snapshot.deployment,
+		CheckedAt:  snapshot.checkedAt,
+		Age:        time.Since(snapshot.checkedAt).Round(time.Millisecond).String(),
 	}
 
+	workers, workersHealthy := h.workers.ready()
+	resp.Workers = workers
+
+	checks, checksHealthy := waitForChecks()
+	resp.Checks = checks
+	resp.Healthy = resp.Healthy && checksHealthy && workersHealthy
+
 	statusCode := http.StatusOK
 	if !resp.Healthy {
 		statusCode = http.StatusServiceUnavailable
@@ -179,53 +351,14 @@ func (h *healthcheck) serveReadiness(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *healthcheck) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	switch r.URL.Path {
-	case "/livez":
+	switch {
+	case slices.Contains(h.livenessPaths, r.URL.Path):
 		h.serveLiveness(w, r)
-	case "/readyz", "/health":
+	case slices.Contains(h.readinessPaths, r.URL.Path):
 		h.serveReadiness(w, r)
+	case slices.Contains(h.startupPaths, r.URL.Path):
+		h.serveStartup(w, r)
 	default:
 		http.NotFound(w, r)
 	}
 }
-
-func NewHealthCheck(ctx context.Context, taskQueues []string, address string, c client.Client) {
-	h := &healthcheck{
-		client:     c,
-		taskQueues: taskQueues,
-		timeout:    2 * time.Second,
-	}
-
-	mux := http.NewServeMux()
-	mux.Handle("/", h)
-
-	srv := &http.Server{
-		Addr:              address,
-		ReadHeaderTimeout: time.Second,
-		ReadTimeout:       time.Second,
-		WriteTimeout:      time.Second,
-		Handler:           mux,
-	}
-
-	go func() {
-		<-ctx.Done()
-
-		shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
-		defer cancel()
-
-		if err := srv.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			log.Error().Err(err).Msg("Error shutting down healthcheck service")
-		}
-	}()
-
-	go func() {
-		log.Info().
-			Str("address", address).
-			Int("taskQueueCount", len(taskQueues)).
-			Msg("Starting healthcheck service")
-
-		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			log.Fatal().Err(err).Msg("Error serving health check connection")
-		}
-	}()
-}
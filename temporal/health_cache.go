@@ -0,0 +1,219 @@
+/*
+ * Copyright 2023 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package temporal
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mrsimonemms/golang-helpers/logger"
+	enumspb "go.temporal.io/api/enums/v1"
+)
+
+// readinessSnapshot is the result of the Temporal and task queue checks at a
+// point in time
+type readinessSnapshot struct {
+	healthy    bool
+	temporalOK bool
+	err        string
+	taskQueues []taskQueueHealth
+	deployment *deploymentHealth
+	checkedAt  time.Time
+}
+
+type readinessCache struct {
+	ttl             time.Duration
+	refreshInterval time.Duration
+
+	// refreshMu stops concurrent probes checking Temporal at the same time
+	refreshMu sync.Mutex
+	mu        sync.RWMutex
+	snapshot  *readinessSnapshot
+
+	startOnce sync.Once
+	stopOnce  sync.Once
+	stop      chan struct{}
+}
+
+// WithHealthConcurrency sets how many task queue checks run at once. Defaults
+// to 4.
+func WithHealthConcurrency(n int) HealthCheckOption {
+	return func(h *healthcheck) {
+		h.concurrency = max(n, 1)
+	}
+}
+
+// WithHealthCacheTTL reuses the readiness result for the duration, rather
+// than checking Temporal on every probe
+func WithHealthCacheTTL(ttl time.Duration) HealthCheckOption {
+	return func(h *healthcheck) {
+		h.cache.ttl = ttl
+	}
+}
+
+// WithHealthRefreshInterval checks readiness in the background at the
+// interval, so probes always return the latest result. It runs from the first
+// probe, or when the server starts, until the server is shut down.
+func WithHealthRefreshInterval(interval time.Duration) HealthCheckOption {
+	return func(h *healthcheck) {
+		h.cache.refreshInterval = interval
+	}
+}
+
+func (c *readinessCache) latest() *readinessSnapshot {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.snapshot
+}
+
+func (c *readinessCache) isFresh(s *readinessSnapshot) bool {
+	if s == nil {
+		return false
+	}
+	if c.refreshInterval > 0 {
+		// The background refresh keeps it up to date
+		return true
+	}
+	return c.ttl > 0 && time.Since(s.checkedAt) < c.ttl
+}
+
+// readiness returns the cached snapshot if it's fresh, otherwise checks again
+func (h *healthcheck) readiness(ctx context.Context) *readinessSnapshot {
+	h.startRefresh()
+
+	if s := h.cache.latest(); h.cache.isFresh(s) {
+		return s
+	}
+
+	h.cache.refreshMu.Lock()
+	defer h.cache.refreshMu.Unlock()
+
+	// Another probe may have refreshed it while this one waited
+	if s := h.cache.latest(); h.cache.isFresh(s) {
+		return s
+	}
+
+	return h.refreshReadiness(ctx)
+}
+
+func (h *healthcheck) refreshReadiness(ctx context.Context) *readinessSnapshot {
+	// The result is shared, so don't let one probe disconnecting cancel it
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), h.timeout)
+	defer cancel()
+
+	s := &readinessSnapshot{
+		healthy:    true,
+		temporalOK: true,
+	}
+
+	if err := h.checkTemporal(ctx); err != nil {
+		logger.Default().Error("Temporal readiness health check failed", "error", err)
+		s.healthy = false
+		s.temporalOK = false
+		s.err = err.Error()
+	} else {
+		s.taskQueues = h.checkTaskQueues(ctx)
+		for _, tq := range s.taskQueues {
+			s.healthy = s.healthy && tq.Healthy
+		}
+
+		if h.deployment != nil {
+			s.deployment = h.checkDeployment(ctx)
+			s.healthy = s.healthy && s.deployment.Healthy
+		}
+	}
+	s.checkedAt = time.Now()
+
+	h.cache.mu.Lock()
+	h.cache.snapshot = s
+	h.cache.mu.Unlock()
+
+	return s
+}
+
+// checkTaskQueues checks each task queue type concurrently, up to the
+// concurrency limit
+func (h *healthcheck) checkTaskQueues(ctx context.Context) []taskQueueHealth {
+	types := []enumspb.TaskQueueType{
+		enumspb.TASK_QUEUE_TYPE_WORKFLOW,
+		enumspb.TASK_QUEUE_TYPE_ACTIVITY,
+	}
+
+	results := make([]taskQueueHealth, len(h.taskQueues))
+	sem := make(chan struct{}, max(h.concurrency, 1))
+
+	var wg sync.WaitGroup
+	for i, tq := range h.taskQueues {
+		results[i] = taskQueueHealth{
+			TaskQueue: tq,
+			Healthy:   true,
+			Checks:    make([]taskQueueTypeHealth, len(types)),
+		}
+
+		for j, t := range types {
+			wg.Go(func() {
+				sem <- struct{}{}
+				defer func() { <-sem }()
+
+				results[i].Checks[j] = h.checkTaskQueue(ctx, tq, t)
+			})
+		}
+	}
+	wg.Wait()
+
+	for i := range results {
+		for _, check := range results[i].Checks {
+			results[i].Healthy = results[i].Healthy && check.Healthy
+		}
+	}
+
+	return results
+}
+
+// startRefresh starts the background refresh, if it's configured
+func (h *healthcheck) startRefresh() {
+	if h.cache.refreshInterval <= 0 {
+		return
+	}
+
+	h.cache.startOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(h.cache.refreshInterval)
+			defer ticker.Stop()
+
+			// Until the first tick, probes check for themselves
+			for {
+				select {
+				case <-h.cache.stop:
+					return
+				case <-ticker.C:
+				}
+
+				h.cache.refreshMu.Lock()
+				h.refreshReadiness(context.Background())
+				h.cache.refreshMu.Unlock()
+			}
+		}()
+	})
+}
+
+func (h *healthcheck) stopRefresh() {
+	h.cache.stopOnce.Do(func() {
+		close(h.cache.stop)
+	})
+}
@@ -0,0 +1,175 @@
+/*
+ * Copyright 2023 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package temporal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mrsimonemms/golang-helpers/logger"
+)
+
+type HealthCheckKind string
+
+const (
+	HealthCheckLiveness  HealthCheckKind = "liveness"
+	HealthCheckReadiness HealthCheckKind = "readiness"
+)
+
+// HealthCheck is a custom check, such as a database ping, that's reported
+// alongside the Temporal checks
+type HealthCheck struct {
+	Name string
+	Kind HealthCheckKind
+	// Critical checks fail the endpoint. Other failures are only reported.
+	Critical bool
+	// Timeout defaults to the health server's timeout
+	Timeout time.Duration
+	Check   func(ctx context.Context) error
+}
+
+type healthCheckResult struct {
+	Name     string `json:"name"`
+	Healthy  bool   `json:"healthy"`
+	Critical bool   `json:"critical"`
+	Duration string `json:"duration"`
+	Error    string `json:"error,omitempty"`
+}
+
+type customChecks struct {
+	mu     sync.RWMutex
+	checks []HealthCheck
+}
+
+// AddCheck registers a custom check. It can be called before or after the
+// server has started. Names must be unique.
+func (s *HealthServer) AddCheck(check HealthCheck) error {
+	if check.Name == "" {
+		return errors.New("health check name required")
+	}
+	if check.Check == nil {
+		return fmt.Errorf("health check function required: %s", check.Name)
+	}
+	if check.Kind != HealthCheckLiveness && check.Kind != HealthCheckReadiness {
+		return fmt.Errorf("unknown health check kind: %s", check.Kind)
+	}
+
+	s.h.custom.mu.Lock()
+	defer s.h.custom.mu.Unlock()
+
+	for _, c := range s.h.custom.checks {
+		if c.Name == check.Name {
+			return fmt.Errorf("health check already registered: %s", check.Name)
+		}
+	}
+
+	s.h.custom.checks = append(s.h.custom.checks, check)
+	return nil
+}
+
+// runCustomChecks runs the checks of the kind concurrently, each with its own
+// timeout. It's unhealthy if any critical check fails.
+func (h *healthcheck) runCustomChecks(ctx context.Context, kind HealthCheckKind) (results []healthCheckResult, healthy bool) {
+	h.custom.mu.RLock()
+	checks := make([]HealthCheck, 0, len(h.custom.checks))
+	for _, c := range h.custom.checks {
+		if c.Kind == kind {
+			checks = append(checks, c)
+		}
+	}
+	h.custom.mu.RUnlock()
+
+	results = make([]healthCheckResult, len(checks))
+
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Go(func() {
+			results[i] = h.runCustomCheck(ctx, c)
+		})
+	}
+	wg.Wait()
+
+	healthy = true
+	for _, r := range results {
+		if !r.Healthy && r.Critical {
+			healthy = false
+		}
+	}
+
+	return results, healthy
+}
+
+func (h *healthcheck) runCustomCheck(ctx context.Context, c HealthCheck) healthCheckResult {
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = h.timeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+
+	// Run in the background, so a check that ignores the context can't hold
+	// up the response
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.Check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+		err = fmt.Errorf("health check timed out: %w", ctx.Err())
+	}
+
+	result := healthCheckResult{
+		Name:     c.Name,
+		Healthy:  err == nil,
+		Critical: c.Critical,
+		Duration: time.Since(start).String(),
+	}
+
+	if err != nil {
+		result.Error = err.Error()
+		logger.Default().Error("Health check failed",
+			"error", err,
+			"check", c.Name,
+			"kind", c.Kind,
+			"critical", c.Critical,
+		)
+	}
+
+	return result
+}
+
+// maxTimeout is the longest a check can take, so the response is written
+// before the server's write timeout
+func (h *healthcheck) maxTimeout() time.Duration {
+	h.custom.mu.RLock()
+	defer h.custom.mu.RUnlock()
+
+	timeout := h.timeout
+	for _, c := range h.custom.checks {
+		timeout = max(timeout, c.Timeout)
+	}
+	return timeout
+}
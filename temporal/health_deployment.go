@@ -0,0 +1,143 @@
+/*
+ * Copyright 2023 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package temporal
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/mrsimonemms/golang-helpers/logger"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/worker"
+)
+
+// DeploymentStatus is where a worker deployment version is in its rollout
+type DeploymentStatus string
+
+const (
+	// DeploymentCurrent receives new workflows
+	DeploymentCurrent DeploymentStatus = "current"
+	// DeploymentRamping receives a percentage of new workflows
+	DeploymentRamping DeploymentStatus = "ramping"
+	// DeploymentDraining only runs existing pinned workflows
+	DeploymentDraining DeploymentStatus = "draining"
+	// DeploymentDrained has no open workflows
+	DeploymentDrained DeploymentStatus = "drained"
+	// DeploymentInactive is known to the deployment, but has never been current
+	// or ramping
+	DeploymentInactive DeploymentStatus = "inactive"
+	// DeploymentUnknown isn't part of the deployment
+	DeploymentUnknown DeploymentStatus = "unknown"
+)
+
+type deploymentHealth struct {
+	DeploymentName    string           `json:"deploymentName"`
+	BuildID           string           `json:"buildId"`
+	Status            DeploymentStatus `json:"status,omitempty"`
+	Healthy           bool             `json:"healthy"`
+	Error             string           `json:"error,omitempty"`
+	RampingPercentage float32          `json:"rampingPercentage,omitempty"`
+	CurrentBuildID    string           `json:"currentBuildId,omitempty"`
+}
+
+// WithHealthDeploymentVersion reports where the worker's deployment version
+// is in its rollout in the readiness response
+func WithHealthDeploymentVersion(deploymentName, buildID string) HealthCheckOption {
+	return func(h *healthcheck) {
+		h.deployment = &worker.WorkerDeploymentVersion{
+			DeploymentName: deploymentName,
+			BuildID:        buildID,
+		}
+	}
+}
+
+// WithHealthRequireDeploymentStatus makes readiness fail unless the deployment
+// version has one of the statuses. Without this, the status is only reported.
+func WithHealthRequireDeploymentStatus(statuses ...DeploymentStatus) HealthCheckOption {
+	return func(h *healthcheck) {
+		h.deploymentStatuses = statuses
+	}
+}
+
+func (h *healthcheck) checkDeployment(ctx context.Context) *deploymentHealth {
+	result := &deploymentHealth{
+		DeploymentName: h.deployment.DeploymentName,
+		BuildID:        h.deployment.BuildID,
+		Healthy:        true,
+	}
+
+	resp, err := h.client.WorkerDeploymentClient().
+		GetHandle(h.deployment.DeploymentName).
+		Describe(ctx, client.WorkerDeploymentDescribeOptions{})
+	if err != nil {
+		logger.Default().Error("Error describing worker deployment",
+			"error", err,
+			"deploymentName", h.deployment.DeploymentName,
+		)
+		result.Error = fmt.Sprintf("error describing worker deployment: %s", err)
+		result.Healthy = len(h.deploymentStatuses) == 0
+		return result
+	}
+
+	routing := resp.Info.RoutingConfig
+	if routing.CurrentVersion != nil {
+		result.CurrentBuildID = routing.CurrentVersion.BuildID
+	}
+
+	result.Status = h.deploymentStatus(resp.Info)
+	if result.Status == DeploymentRamping {
+		result.RampingPercentage = routing.RampingVersionPercentage
+	}
+
+	if len(h.deploymentStatuses) > 0 && !slices.Contains(h.deploymentStatuses, result.Status) {
+		result.Healthy = false
+		result.Error = fmt.Sprintf("deployment version is %s", result.Status)
+	}
+
+	return result
+}
+
+func (h *healthcheck) deploymentStatus(info client.WorkerDeploymentInfo) DeploymentStatus {
+	isVersion := func(v *worker.WorkerDeploymentVersion) bool {
+		return v != nil && *v == *h.deployment
+	}
+
+	if isVersion(info.RoutingConfig.CurrentVersion) {
+		return DeploymentCurrent
+	}
+	if isVersion(info.RoutingConfig.RampingVersion) {
+		return DeploymentRamping
+	}
+
+	for _, v := range info.VersionSummaries {
+		if !isVersion(&v.Version) {
+			continue
+		}
+
+		switch v.DrainageStatus {
+		case client.WorkerDeploymentVersionDrainageStatusDraining:
+			return DeploymentDraining
+		case client.WorkerDeploymentVersionDrainageStatusDrained:
+			return DeploymentDrained
+		default:
+			return DeploymentInactive
+		}
+	}
+
+	return DeploymentUnknown
+}
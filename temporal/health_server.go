@@ -0,0 +1,254 @@
+/*
+ * Copyright 2023 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package temporal
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mrsimonemms/golang-helpers/logger"
+	"go.temporal.io/sdk/client"
+)
+
+// HealthServer serves the Temporal liveness, readiness and startup checks over
+// HTTP
+type HealthServer struct {
+	h       *healthcheck
+	address string
+
+	mu       sync.Mutex
+	srv      *http.Server
+	serveErr error
+	done     chan struct{}
+}
+
+// NewHealthServer creates the health server without starting it. Use Start to
+// listen on the address, or Handler to mount it on an existing server.
+//
+// The task queue backlog is only reported with WithHealthNamespace, as the
+// client doesn't expose its namespace. Pass the one the client connects to. A
+// warning is logged if it's missing.
+func NewHealthServer(taskQueues []string, address string, c client.Client, opts ...HealthCheckOption) *HealthServer {
+	h := &healthcheck{
+		client:         c,
+		taskQueues:     taskQueues,
+		timeout:        2 * time.Second,
+		pollerRecency:  2 * time.Minute,
+		requirePollers: true,
+		livenessPaths:  []string{"/livez"},
+		readinessPaths: []string{"/readyz", "/health"},
+		startupPaths:   []string{"/startupz"},
+		concurrency:    4,
+		cache: readinessCache{
+			stop: make(chan struct{}),
+		},
+	}
+	for _, o := range opts {
+		o(h)
+	}
+
+	if len(taskQueues) > 0 && h.namespace == "" {
+		logger.Default().Warn("Task queue backlog isn't reported without WithHealthNamespace", "taskQueues", taskQueues)
+	}
+
+	return &HealthServer{
+		h:       h,
+		address: address,
+	}
+}
+
+// NewHealthCheck creates and starts the health server. It's shut down when
+// the context is cancelled. Set WithHealthNamespace to the client's namespace
+// to report the task queue backlog.
+func NewHealthCheck(
+	ctx context.Context,
+	taskQueues []string,
+	address string,
+	c client.Client,
+	opts ...HealthCheckOption,
+) (*HealthServer, error) {
+	s := NewHealthServer(taskQueues, address, c, opts...)
+	if err := s.Start(); err != nil {
+		return nil, err
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-s.done:
+			return
+		}
+
+		shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		defer cancel()
+
+		if err := s.Shutdown(shutdownCtx); err != nil {
+			logger.Default().Error("Error shutting down healthcheck service", "error", err)
+		}
+	}()
+
+	return s, nil
+}
+
+// WithHealthTimeout sets how long the checks for each request can take.
+// Defaults to 2 seconds.
+func WithHealthTimeout(timeout time.Duration) HealthCheckOption {
+	return func(h *healthcheck) {
+		h.timeout = timeout
+	}
+}
+
+// WithHealthLivenessPaths replaces the liveness paths. Defaults to /livez.
+func WithHealthLivenessPaths(paths ...string) HealthCheckOption {
+	return func(h *healthcheck) {
+		h.livenessPaths = paths
+	}
+}
+
+// WithHealthReadinessPaths replaces the readiness paths. Defaults to /readyz
+// and /health.
+func WithHealthReadinessPaths(paths ...string) HealthCheckOption {
+	return func(h *healthcheck) {
+		h.readinessPaths = paths
+	}
+}
+
+// WithHealthTLS serves the health checks over TLS with the certificate files
+func WithHealthTLS(certFile, keyFile string) HealthCheckOption {
+	return func(h *healthcheck) {
+		h.tlsCertFile = certFile
+		h.tlsKeyFile = keyFile
+	}
+}
+
+// WithHealthTLSConfig serves the health checks over TLS with the config
+func WithHealthTLSConfig(cfg *tls.Config) HealthCheckOption {
+	return func(h *healthcheck) {
+		h.tlsConfig = cfg
+	}
+}
+
+// Handler returns the HTTP handler for the health checks, which routes on
+// the configured paths
+func (s *HealthServer) Handler() http.Handler {
+	return s.h
+}
+
+func (s *HealthServer) tlsConfig() (*tls.Config, error) {
+	if s.h.tlsCertFile == "" && s.h.tlsKeyFile == "" {
+		return s.h.tlsConfig, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(s.h.tlsCertFile, s.h.tlsKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("error loading health check tls key pair: %w", err)
+	}
+
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if s.h.tlsConfig != nil {
+		cfg = s.h.tlsConfig.Clone()
+	}
+	cfg.Certificates = append(cfg.Certificates, cert)
+
+	return cfg, nil
+}
+
+// Start listens on the address and serves in the background. Errors binding
+// the address are returned, rather than ending the program.
+func (s *HealthServer) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.srv != nil {
+		return errors.New("health server already started")
+	}
+
+	tlsConfig, err := s.tlsConfig()
+	if err != nil {
+		return err
+	}
+
+	lis, err := net.Listen("tcp", s.address) //nolint:noctx // The listener outlives any context here
+	if err != nil {
+		return fmt.Errorf("error listening for health checks: %w", err)
+	}
+	if tlsConfig != nil {
+		lis = tls.NewListener(lis, tlsConfig)
+	}
+
+	s.srv = &http.Server{
+		ReadHeaderTimeout: time.Second,
+		ReadTimeout:       time.Second,
+		// Allow the checks to time out before the write does
+		WriteTimeout: s.h.maxTimeout() + time.Second,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Checks added after starting may have a longer timeout
+			_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(s.h.maxTimeout() + time.Second))
+			s.h.ServeHTTP(w, r)
+		}),
+	}
+	s.done = make(chan struct{})
+	s.h.startRefresh()
+
+	logger.Default().Info("Starting healthcheck service",
+		"address", lis.Addr().String(),
+		"taskQueueCount", len(s.h.taskQueues),
+		"tls", tlsConfig != nil,
+	)
+
+	go func() {
+		defer close(s.done)
+
+		if err := s.srv.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Default().Error("Error serving health check connection", "error", err)
+
+			s.mu.Lock()
+			s.serveErr = err
+			s.mu.Unlock()
+		}
+	}()
+
+	return nil
+}
+
+// Shutdown gracefully stops the server and any background refresh. It returns any error from shutting
+// down, or from serving if the server had already stopped.
+func (s *HealthServer) Shutdown(ctx context.Context) error {
+	s.h.stopRefresh()
+
+	s.mu.Lock()
+	srv := s.srv
+	s.mu.Unlock()
+
+	if srv == nil {
+		return nil
+	}
+
+	if err := srv.Shutdown(ctx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("error shutting down health server: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.serveErr
+}
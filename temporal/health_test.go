@@ -0,0 +1,674 @@
+/*
+ * Copyright 2023 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package temporal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mrsimonemms/golang-helpers/logger"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	enumspb "go.temporal.io/api/enums/v1"
+	taskqueuepb "go.temporal.io/api/taskqueue/v1"
+	"go.temporal.io/api/workflowservice/v1"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/worker"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestCheckPollers(t *testing.T) {
+	recent := &taskqueuepb.PollerInfo{
+		Identity:       "local",
+		LastAccessTime: timestamppb.New(time.Now().Add(-time.Second * 10)),
+	}
+	old := &taskqueuepb.PollerInfo{
+		Identity:       "old",
+		LastAccessTime: timestamppb.New(time.Now().Add(-time.Hour)),
+	}
+
+	tests := []struct {
+		Name        string
+		Options     []HealthCheckOption
+		Pollers     []*taskqueuepb.PollerInfo
+		Healthy     bool
+		LocalPoller bool
+	}{
+		{
+			Name:    "no pollers",
+			Healthy: false,
+		},
+		{
+			Name:    "no pollers not required",
+			Options: []HealthCheckOption{WithHealthRequirePollers(false)},
+			Healthy: true,
+		},
+		{
+			Name:    "recent poller",
+			Pollers: []*taskqueuepb.PollerInfo{old, recent},
+			Healthy: true,
+		},
+		{
+			Name:    "only old pollers",
+			Pollers: []*taskqueuepb.PollerInfo{old},
+			Healthy: false,
+		},
+		{
+			Name:        "local identity polling",
+			Options:     []HealthCheckOption{WithHealthPollerIdentity("local")},
+			Pollers:     []*taskqueuepb.PollerInfo{old, recent},
+			Healthy:     true,
+			LocalPoller: true,
+		},
+		{
+			Name:    "local identity stale",
+			Options: []HealthCheckOption{WithHealthPollerIdentity("old")},
+			Pollers: []*taskqueuepb.PollerInfo{old, recent},
+			Healthy: false,
+		},
+		{
+			Name:    "wider recency window",
+			Options: []HealthCheckOption{WithHealthPollerRecency(time.Hour * 2)},
+			Pollers: []*taskqueuepb.PollerInfo{old},
+			Healthy: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			h := &healthcheck{
+				pollerRecency:  2 * time.Minute,
+				requirePollers: true,
+			}
+			for _, o := range test.Options {
+				o(h)
+			}
+
+			res := h.checkPollers(test.Pollers)
+
+			assert.Equal(t, test.Healthy, res.Healthy)
+			assert.Equal(t, test.LocalPoller, res.LocalPoller)
+			assert.Equal(t, len(test.Pollers), res.PollerCount)
+			if test.Healthy {
+				assert.Empty(t, res.Error)
+			} else {
+				assert.NotEmpty(t, res.Error)
+			}
+		})
+	}
+}
+
+type fakeHealthClient struct {
+	client.Client
+	healthErr     error
+	describeCalls atomic.Int32
+}
+
+func (f *fakeHealthClient) CheckHealth(context.Context, *client.CheckHealthRequest) (*client.CheckHealthResponse, error) {
+	return &client.CheckHealthResponse{}, f.healthErr
+}
+
+func (f *fakeHealthClient) DescribeTaskQueue(
+	context.Context,
+	string,
+	enumspb.TaskQueueType,
+) (*workflowservice.DescribeTaskQueueResponse, error) {
+	f.describeCalls.Add(1)
+	return &workflowservice.DescribeTaskQueueResponse{
+		Pollers: []*taskqueuepb.PollerInfo{
+			{Identity: "worker", LastAccessTime: timestamppb.Now()},
+		},
+	}, nil
+}
+
+func (f *fakeHealthClient) WorkflowService() workflowservice.WorkflowServiceClient {
+	return &fakeWorkflowService{}
+}
+
+// fakeWorkflowService reports stats for the namespace it's asked about
+type fakeWorkflowService struct {
+	workflowservice.WorkflowServiceClient
+}
+
+func (f *fakeWorkflowService) DescribeTaskQueue(
+	_ context.Context,
+	req *workflowservice.DescribeTaskQueueRequest,
+	_ ...grpc.CallOption,
+) (*workflowservice.DescribeTaskQueueResponse, error) {
+	return &workflowservice.DescribeTaskQueueResponse{
+		Pollers: []*taskqueuepb.PollerInfo{
+			{Identity: "worker", LastAccessTime: timestamppb.Now()},
+		},
+		Stats: &taskqueuepb.TaskQueueStats{ApproximateBacklogCount: int64(len(req.GetNamespace()))},
+	}, nil
+}
+
+func TestHealthServerBacklog(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Options  []HealthCheckOption
+		Contains string
+		Warning  bool
+	}{
+		{
+			Name:    "without namespace",
+			Warning: true,
+		},
+		{
+			Name:     "with namespace",
+			Options:  []HealthCheckOption{WithHealthNamespace("my-namespace")},
+			Contains: `"approximateCount":12`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			var logs bytes.Buffer
+			logger.UseHandler(slog.NewJSONHandler(&logs, nil))
+			t.Cleanup(func() {
+				logger.UseZerolog(&log.Logger)
+			})
+
+			s := NewHealthServer([]string{"queue"}, "", &fakeHealthClient{}, test.Options...)
+			assert.Equal(t, test.Warning, strings.Contains(logs.String(), "without WithHealthNamespace"))
+
+			rec := httptest.NewRecorder()
+			s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", http.NoBody))
+			assert.Equal(t, http.StatusOK, rec.Code)
+
+			if test.Contains == "" {
+				assert.NotContains(t, rec.Body.String(), `"backlog"`)
+				return
+			}
+			assert.Contains(t, rec.Body.String(), test.Contains)
+		})
+	}
+}
+
+func TestHealthServerHandler(t *testing.T) {
+	c := &fakeHealthClient{}
+	s := NewHealthServer(nil, "", c, WithHealthLivenessPaths("/alive"))
+
+	tests := []struct {
+		Name      string
+		Path      string
+		HealthErr error
+		Status    int
+	}{
+		{
+			Name:   "custom liveness path",
+			Path:   "/alive",
+			Status: http.StatusOK,
+		},
+		{
+			Name:      "liveness failure",
+			Path:      "/alive",
+			HealthErr: errors.New("down"),
+			Status:    http.StatusServiceUnavailable,
+		},
+		{
+			Name:   "default liveness path replaced",
+			Path:   "/livez",
+			Status: http.StatusNotFound,
+		},
+		{
+			Name:   "readiness without task queues",
+			Path:   "/readyz",
+			Status: http.StatusOK,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			c.healthErr = test.HealthErr
+
+			rec := httptest.NewRecorder()
+			s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, test.Path, http.NoBody))
+
+			assert.Equal(t, test.Status, rec.Code)
+		})
+	}
+}
+
+func TestHealthServerStart(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = lis.Close()
+	})
+
+	// The port is in use, so this should fail rather than exit
+	s := NewHealthServer(nil, lis.Addr().String(), &fakeHealthClient{})
+	assert.Error(t, s.Start())
+	assert.NoError(t, s.Shutdown(context.Background()))
+
+	s = NewHealthServer(nil, "127.0.0.1:0", &fakeHealthClient{})
+	require.NoError(t, s.Start())
+	assert.Error(t, s.Start())
+	assert.NoError(t, s.Shutdown(context.Background()))
+}
+
+func TestHealthServerCustomChecks(t *testing.T) {
+	s := NewHealthServer(nil, "", &fakeHealthClient{})
+
+	errCheck := func(context.Context) error { return errors.New("check failed") }
+	okCheck := func(context.Context) error { return nil }
+
+	require.NoError(t, s.AddCheck(HealthCheck{Name: "database", Kind: HealthCheckReadiness, Critical: true, Check: okCheck}))
+	require.NoError(t, s.AddCheck(HealthCheck{Name: "cache", Kind: HealthCheckReadiness, Check: errCheck}))
+	assert.Error(t, s.AddCheck(HealthCheck{Name: "cache", Kind: HealthCheckReadiness, Check: okCheck}))
+	assert.Error(t, s.AddCheck(HealthCheck{Name: "unknown", Kind: "other", Check: okCheck}))
+	assert.Error(t, s.AddCheck(HealthCheck{Name: "nil", Kind: HealthCheckLiveness}))
+
+	// Non-critical failures are reported, but stay healthy
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", http.NoBody))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"name":"cache","healthy":false`)
+
+	require.NoError(t, s.AddCheck(HealthCheck{
+		Name:     "slow",
+		Kind:     HealthCheckLiveness,
+		Critical: true,
+		Timeout:  time.Millisecond * 10,
+		Check: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}))
+
+	rec = httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/livez", http.NoBody))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Contains(t, rec.Body.String(), "deadline exceeded")
+}
+
+func TestHealthServerCustomCheckIgnoresContext(t *testing.T) {
+	s := NewHealthServer(nil, "", &fakeHealthClient{})
+
+	block := make(chan struct{})
+	t.Cleanup(func() { close(block) })
+
+	require.NoError(t, s.AddCheck(HealthCheck{
+		Name:     "stuck",
+		Kind:     HealthCheckReadiness,
+		Critical: true,
+		Timeout:  time.Millisecond * 10,
+		Check: func(context.Context) error {
+			<-block
+			return nil
+		},
+	}))
+
+	start := time.Now()
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", http.NoBody))
+
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Contains(t, rec.Body.String(), "timed out")
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestHealthServerWriteTimeout(t *testing.T) {
+	addr := closedAddress(t)
+	s := NewHealthServer(nil, addr, &fakeHealthClient{}, WithHealthTimeout(time.Millisecond*50))
+	require.NoError(t, s.Start())
+	t.Cleanup(func() {
+		_ = s.Shutdown(context.Background())
+	})
+
+	// Longer than the server's timeout, so the write timeout must allow for it
+	require.NoError(t, s.AddCheck(HealthCheck{
+		Name:    "slow",
+		Kind:    HealthCheckReadiness,
+		Timeout: time.Second * 2,
+		Check: func(context.Context) error {
+			time.Sleep(time.Millisecond * 1200)
+			return nil
+		},
+	}))
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "http://"+addr+"/readyz", http.NoBody)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestHealthServerReadinessCache(t *testing.T) {
+	taskQueues := []string{"queue-1", "queue-2", "queue-3"}
+
+	tests := []struct {
+		Name          string
+		Options       []HealthCheckOption
+		DescribeCalls int32
+	}{
+		{
+			Name:          "no cache",
+			Options:       []HealthCheckOption{WithHealthConcurrency(2)},
+			DescribeCalls: 18,
+		},
+		{
+			Name:          "cached",
+			Options:       []HealthCheckOption{WithHealthCacheTTL(time.Minute)},
+			DescribeCalls: 6,
+		},
+		{
+			Name:          "background refresh",
+			Options:       []HealthCheckOption{WithHealthRefreshInterval(time.Minute)},
+			DescribeCalls: 6,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			c := &fakeHealthClient{}
+			s := NewHealthServer(taskQueues, "", c, test.Options...)
+			t.Cleanup(func() {
+				_ = s.Shutdown(context.Background())
+			})
+
+			for range 3 {
+				rec := httptest.NewRecorder()
+				s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", http.NoBody))
+
+				assert.Equal(t, http.StatusOK, rec.Code)
+				assert.Contains(t, rec.Body.String(), `"taskQueue":"queue-3"`)
+				assert.Contains(t, rec.Body.String(), `"age":`)
+			}
+
+			assert.Equal(t, test.DescribeCalls, c.describeCalls.Load())
+		})
+	}
+}
+
+type fakeWorker struct {
+	worker.Worker
+	startErr error
+	fatal    chan error
+}
+
+func (f *fakeWorker) Start() error { return f.startErr }
+
+// Run behaves like the SDK's, returning on a start error, an interrupt or a
+// fatal error
+func (f *fakeWorker) Run(interruptCh <-chan any) error {
+	if f.startErr != nil {
+		return f.startErr
+	}
+
+	select {
+	case <-interruptCh:
+		return nil
+	case err := <-f.fatal:
+		return err
+	}
+}
+
+func (f *fakeWorker) Stop() {}
+
+func TestHealthServerWorkers(t *testing.T) {
+	s := NewHealthServer(nil, "", &fakeHealthClient{})
+
+	status := func(path string) int {
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, http.NoBody))
+		return rec.Code
+	}
+
+	w1, err := s.AttachWorker("worker-1", &fakeWorker{})
+	require.NoError(t, err)
+	w2, err := s.AttachWorker("worker-2", &fakeWorker{startErr: errors.New("fatal")})
+	require.NoError(t, err)
+
+	_, err = s.AttachWorker("worker-1", &fakeWorker{})
+	assert.Error(t, err)
+
+	assert.Equal(t, http.StatusServiceUnavailable, status("/startupz"))
+	assert.Equal(t, http.StatusServiceUnavailable, status("/readyz"))
+	assert.Equal(t, http.StatusOK, status("/livez"))
+
+	require.NoError(t, w1.Start())
+	assert.Equal(t, http.StatusServiceUnavailable, status("/startupz"))
+
+	assert.Error(t, w2.Run(nil))
+	assert.Equal(t, http.StatusServiceUnavailable, status("/startupz"))
+	assert.Equal(t, http.StatusServiceUnavailable, status("/readyz"))
+	assert.Equal(t, http.StatusServiceUnavailable, status("/livez"))
+
+	s = NewHealthServer(nil, "", &fakeHealthClient{})
+	w1, err = s.AttachWorker("worker-1", &fakeWorker{})
+	require.NoError(t, err)
+	require.NoError(t, w1.Start())
+
+	assert.Equal(t, http.StatusOK, status("/startupz"))
+	assert.Equal(t, http.StatusOK, status("/readyz"))
+	assert.Equal(t, http.StatusOK, status("/livez"))
+
+	// Stopping isn't a failure, but it's no longer ready
+	w1.Stop()
+	assert.Equal(t, http.StatusOK, status("/startupz"))
+	assert.Equal(t, http.StatusServiceUnavailable, status("/readyz"))
+	assert.Equal(t, http.StatusOK, status("/livez"))
+
+	s.WorkerFatalErrorHandler("worker-1")(errors.New("fatal"))
+	assert.Equal(t, http.StatusServiceUnavailable, status("/livez"))
+}
+
+func TestHealthServerWorkerRun(t *testing.T) {
+	s := NewHealthServer(nil, "", &fakeHealthClient{})
+
+	ready := func() int {
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", http.NoBody))
+		return rec.Code
+	}
+
+	w, err := s.AttachWorker("worker", &fakeWorker{})
+	require.NoError(t, err)
+
+	interruptCh := make(chan any)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- w.Run(interruptCh)
+	}()
+
+	assert.Eventually(t, func() bool { return ready() == http.StatusOK }, time.Second, 10*time.Millisecond)
+
+	close(interruptCh)
+	require.NoError(t, <-errCh)
+	assert.Equal(t, http.StatusServiceUnavailable, ready())
+
+	// A fatal error stops Run and fails liveness, without OnFatalError set
+	s = NewHealthServer(nil, "", &fakeHealthClient{})
+	fatal := make(chan error, 1)
+	w, err = s.AttachWorker("worker", &fakeWorker{fatal: fatal})
+	require.NoError(t, err)
+
+	go func() {
+		errCh <- w.Run(make(chan any))
+	}()
+
+	assert.Eventually(t, func() bool { return ready() == http.StatusOK }, time.Second, 10*time.Millisecond)
+
+	fatal <- errors.New("fatal")
+	assert.EqualError(t, <-errCh, "fatal")
+
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/livez", http.NoBody))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
+
+// fakeDeploymentClient describes a worker deployment
+type fakeDeploymentClient struct {
+	fakeHealthClient
+	deployments *fakeDeployments
+}
+
+type fakeDeployments struct {
+	client.WorkerDeploymentClient
+	client.WorkerDeploymentHandle
+	info        client.WorkerDeploymentInfo
+	describeErr error
+}
+
+func (f *fakeDeploymentClient) WorkerDeploymentClient() client.WorkerDeploymentClient {
+	return f.deployments
+}
+
+func (f *fakeDeployments) GetHandle(string) client.WorkerDeploymentHandle {
+	return f
+}
+
+func (f *fakeDeployments) Describe(context.Context, client.WorkerDeploymentDescribeOptions) (client.WorkerDeploymentDescribeResponse, error) {
+	return client.WorkerDeploymentDescribeResponse{Info: f.info}, f.describeErr
+}
+
+func TestHealthServerDeploymentReadiness(t *testing.T) {
+	version := worker.WorkerDeploymentVersion{DeploymentName: "my-deployment", BuildID: "v2"}
+	current := client.WorkerDeploymentInfo{
+		RoutingConfig: client.WorkerDeploymentRoutingConfig{CurrentVersion: &version},
+	}
+	requireStatus := WithHealthRequireDeploymentStatus(DeploymentCurrent, DeploymentRamping)
+
+	tests := []struct {
+		Name        string
+		Options     []HealthCheckOption
+		Info        client.WorkerDeploymentInfo
+		DescribeErr error
+		Status      int
+		Contains    string
+	}{
+		{
+			Name:     "allowed status",
+			Options:  []HealthCheckOption{requireStatus},
+			Info:     current,
+			Status:   http.StatusOK,
+			Contains: `"status":"current"`,
+		},
+		{
+			Name:     "disallowed status",
+			Options:  []HealthCheckOption{requireStatus},
+			Status:   http.StatusServiceUnavailable,
+			Contains: `"error":"deployment version is unknown"`,
+		},
+		{
+			Name:        "describe error",
+			Options:     []HealthCheckOption{requireStatus},
+			DescribeErr: errors.New("unavailable"),
+			Status:      http.StatusServiceUnavailable,
+			Contains:    "error describing worker deployment: unavailable",
+		},
+		{
+			Name:     "reported only",
+			Status:   http.StatusOK,
+			Contains: `"status":"unknown"`,
+		},
+		{
+			Name:        "describe error reported only",
+			DescribeErr: errors.New("unavailable"),
+			Status:      http.StatusOK,
+			Contains:    "error describing worker deployment: unavailable",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			c := &fakeDeploymentClient{deployments: &fakeDeployments{info: test.Info, describeErr: test.DescribeErr}}
+			s := NewHealthServer(nil, "", c, append(test.Options, WithHealthDeploymentVersion("my-deployment", "v2"))...)
+
+			rec := httptest.NewRecorder()
+			s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", http.NoBody))
+
+			assert.Equal(t, test.Status, rec.Code)
+			assert.Contains(t, rec.Body.String(), test.Contains)
+		})
+	}
+}
+
+func TestDeploymentStatus(t *testing.T) {
+	version := worker.WorkerDeploymentVersion{DeploymentName: "my-deployment", BuildID: "v2"}
+	other := worker.WorkerDeploymentVersion{DeploymentName: "my-deployment", BuildID: "v1"}
+
+	tests := []struct {
+		Name   string
+		Info   client.WorkerDeploymentInfo
+		Status DeploymentStatus
+	}{
+		{
+			Name:   "unknown",
+			Status: DeploymentUnknown,
+		},
+		{
+			Name: "current",
+			Info: client.WorkerDeploymentInfo{
+				RoutingConfig: client.WorkerDeploymentRoutingConfig{CurrentVersion: &version},
+			},
+			Status: DeploymentCurrent,
+		},
+		{
+			Name: "ramping",
+			Info: client.WorkerDeploymentInfo{
+				RoutingConfig: client.WorkerDeploymentRoutingConfig{CurrentVersion: &other, RampingVersion: &version},
+			},
+			Status: DeploymentRamping,
+		},
+		{
+			Name: "draining",
+			Info: client.WorkerDeploymentInfo{
+				RoutingConfig: client.WorkerDeploymentRoutingConfig{CurrentVersion: &other},
+				VersionSummaries: []client.WorkerDeploymentVersionSummary{
+					{Version: other},
+					{Version: version, DrainageStatus: client.WorkerDeploymentVersionDrainageStatusDraining},
+				},
+			},
+			Status: DeploymentDraining,
+		},
+		{
+			Name: "inactive",
+			Info: client.WorkerDeploymentInfo{
+				VersionSummaries: []client.WorkerDeploymentVersionSummary{
+					{Version: version},
+				},
+			},
+			Status: DeploymentInactive,
+		},
+	}
+
+	h := &healthcheck{deployment: &version}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			assert.Equal(t, test.Status, h.deploymentStatus(test.Info))
+		})
+	}
+}
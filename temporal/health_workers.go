@@ -0,0 +1,225 @@
+/*
+ * Copyright 2023 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package temporal
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mrsimonemms/golang-helpers/logger"
+	"go.temporal.io/sdk/worker"
+)
+
+type workerStatus string
+
+const (
+	workerPending workerStatus = "pending"
+	workerRunning workerStatus = "running"
+	workerStopped workerStatus = "stopped"
+	workerFailed  workerStatus = "failed"
+)
+
+type workerHealth struct {
+	Name      string       `json:"name"`
+	Status    workerStatus `json:"status"`
+	Error     string       `json:"error,omitempty"`
+	StartedAt *time.Time   `json:"startedAt,omitempty"`
+}
+
+type workerStates struct {
+	mu      sync.RWMutex
+	workers []*workerHealth
+}
+
+type startupResponse struct {
+	Healthy bool           `json:"healthy"`
+	Workers []workerHealth `json:"workers,omitempty"`
+}
+
+// monitoredWorker records the worker's state as it's started and stopped
+type monitoredWorker struct {
+	worker.Worker
+	name   string
+	states *workerStates
+}
+
+// WithHealthStartupPaths replaces the startup paths. Defaults to /startupz.
+func WithHealthStartupPaths(paths ...string) HealthCheckOption {
+	return func(h *healthcheck) {
+		h.startupPaths = paths
+	}
+}
+
+// AttachWorker wraps the worker so the health checks follow its state. Use the
+// returned worker in place of the original. Names must be unique.
+// Readiness and startup are unhealthy until it has started, and liveness fails
+// if it stops with an error.
+//
+// Errors are seen when using Run. When using Start, set
+// worker.Options.OnFatalError with WorkerFatalErrorHandler.
+func (s *HealthServer) AttachWorker(name string, w worker.Worker) (worker.Worker, error) {
+	s.h.workers.mu.Lock()
+	defer s.h.workers.mu.Unlock()
+
+	for _, existing := range s.h.workers.workers {
+		if existing.Name == name {
+			return nil, fmt.Errorf("worker already attached: %s", name)
+		}
+	}
+
+	s.h.workers.workers = append(s.h.workers.workers, &workerHealth{
+		Name:   name,
+		Status: workerPending,
+	})
+
+	return &monitoredWorker{
+		Worker: w,
+		name:   name,
+		states: &s.h.workers,
+	}, nil
+}
+
+// WorkerFatalErrorHandler returns a function for worker.Options.OnFatalError
+// that marks the attached worker as failed
+func (s *HealthServer) WorkerFatalErrorHandler(name string) func(error) {
+	return func(err error) {
+		s.h.workers.set(name, workerFailed, err)
+	}
+}
+
+func (m *monitoredWorker) Start() error {
+	if err := m.Worker.Start(); err != nil {
+		m.states.set(m.name, workerFailed, err)
+		return err
+	}
+
+	m.states.set(m.name, workerRunning, nil)
+	return nil
+}
+
+// Run runs the worker until it's interrupted or stops with an error, which
+// marks it as failed
+func (m *monitoredWorker) Run(interruptCh <-chan any) error {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- m.Worker.Run(interruptCh)
+	}()
+
+	// Run only returns once the worker stops, so it's running until then. An
+	// error starting it returns straight away and marks it as failed.
+	m.states.set(m.name, workerRunning, nil)
+
+	if err := <-errCh; err != nil {
+		m.states.set(m.name, workerFailed, err)
+		return err
+	}
+
+	m.states.set(m.name, workerStopped, nil)
+	return nil
+}
+
+func (m *monitoredWorker) Stop() {
+	m.Worker.Stop()
+	m.states.set(m.name, workerStopped, nil)
+}
+
+func (s *workerStates) set(name string, status workerStatus, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, w := range s.workers {
+		if w.Name != name {
+			continue
+		}
+
+		// A failure is kept, so the stop that follows doesn't hide it
+		if w.Status == workerFailed && status == workerStopped {
+			return
+		}
+
+		if status == workerRunning && w.StartedAt == nil {
+			now := time.Now()
+			w.StartedAt = &now
+		}
+		if err != nil {
+			w.Error = err.Error()
+			logger.Default().Error("Temporal worker stopped", "error", err, "worker", name)
+		}
+		w.Status = status
+	}
+}
+
+// snapshot returns a copy of the worker states
+func (s *workerStates) snapshot() []workerHealth {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]workerHealth, 0, len(s.workers))
+	for _, w := range s.workers {
+		out = append(out, *w)
+	}
+	return out
+}
+
+// ready is true when every worker is running
+func (s *workerStates) ready() ([]workerHealth, bool) {
+	workers := s.snapshot()
+	for _, w := range workers {
+		if w.Status != workerRunning {
+			return workers, false
+		}
+	}
+	return workers, true
+}
+
+// live is true unless a worker has failed
+func (s *workerStates) live() ([]workerHealth, bool) {
+	workers := s.snapshot()
+	for _, w := range workers {
+		if w.Status == workerFailed {
+			return workers, false
+		}
+	}
+	return workers, true
+}
+
+// started is true when every worker has started, even if it's since stopped
+func (s *workerStates) started() ([]workerHealth, bool) {
+	workers := s.snapshot()
+	for _, w := range workers {
+		if w.StartedAt == nil || w.Status == workerFailed {
+			return workers, false
+		}
+	}
+	return workers, true
+}
+
+func (h *healthcheck) serveStartup(w http.ResponseWriter, _ *http.Request) {
+	workers, healthy := h.workers.started()
+
+	statusCode := http.StatusOK
+	if !healthy {
+		statusCode = http.StatusServiceUnavailable
+	}
+
+	writeJSON(w, statusCode, startupResponse{
+		Healthy: healthy,
+		Workers: workers,
+	})
+}
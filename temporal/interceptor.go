@@ -0,0 +1,74 @@
+/*
+ * Copyright 2023 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package temporal
+
+import (
+	"context"
+
+	"github.com/mrsimonemms/golang-helpers/logger"
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/interceptor"
+)
+
+// loggerInterceptor puts a logger with the workflow and activity details in
+// each activity's context, so activities can use logger.FromContext
+type loggerInterceptor struct {
+	interceptor.InterceptorBase
+}
+
+type loggerActivityInterceptor struct {
+	interceptor.ActivityInboundInterceptorBase
+}
+
+// NewLoggerInterceptor returns the interceptor that adds the request-scoped
+// logger to activities. Connections created by this package add it by default.
+func NewLoggerInterceptor() interceptor.Interceptor {
+	return &loggerInterceptor{}
+}
+
+func (i *loggerInterceptor) InterceptActivity(
+	ctx context.Context,
+	next interceptor.ActivityInboundInterceptor,
+) interceptor.ActivityInboundInterceptor {
+	a := &loggerActivityInterceptor{}
+	a.Next = next
+	return a
+}
+
+func (a *loggerActivityInterceptor) ExecuteActivity(
+	ctx context.Context,
+	in *interceptor.ExecuteActivityInput,
+) (any, error) {
+	info := activity.GetInfo(ctx)
+
+	args := []any{
+		logger.KeyNamespace, info.WorkflowNamespace,
+		logger.KeyTaskQueue, info.TaskQueue,
+		logger.KeyWorkflowID, info.WorkflowExecution.ID,
+		logger.KeyRunID, info.WorkflowExecution.RunID,
+		logger.KeyActivityID, info.ActivityID,
+		logger.KeyActivityType, info.ActivityType.Name,
+	}
+	// Standalone activities have no workflow type
+	if info.WorkflowType != nil {
+		args = append(args, logger.KeyWorkflowType, info.WorkflowType.Name)
+	}
+
+	ctx = logger.WithContext(ctx, args...)
+
+	return a.Next.ExecuteActivity(ctx, in)
+}
@@ -17,16 +17,72 @@
 package temporal
 
 import (
+	"context"
 	"log/slog"
 
+	"github.com/mrsimonemms/golang-helpers/logger"
 	"github.com/rs/zerolog"
 	slogzerolog "github.com/samber/slog-zerolog/v2"
 	"go.temporal.io/sdk/log"
 )
 
+// temporalKeys maps the keys the Temporal SDK logs with to the shared
+// request-scoped keys, so workflow logs correlate with everything else
+var temporalKeys = map[string]string{
+	"ActivityID":   logger.KeyActivityID,
+	"ActivityType": logger.KeyActivityType,
+	"Namespace":    logger.KeyNamespace,
+	"RunID":        logger.KeyRunID,
+	"TaskQueue":    logger.KeyTaskQueue,
+	"WorkflowID":   logger.KeyWorkflowID,
+	"WorkflowType": logger.KeyWorkflowType,
+}
+
+// temporalKeysHandler renames the Temporal SDK's keys to the shared keys
+type temporalKeysHandler struct {
+	slog.Handler
+}
+
+func (h *temporalKeysHandler) Handle(ctx context.Context, r slog.Record) error {
+	out := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		out.AddAttrs(renameTemporalKey(a))
+		return true
+	})
+	return h.Handler.Handle(ctx, out)
+}
+
+func (h *temporalKeysHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	out := make([]slog.Attr, 0, len(attrs))
+	for _, a := range attrs {
+		out = append(out, renameTemporalKey(a))
+	}
+	return &temporalKeysHandler{Handler: h.Handler.WithAttrs(out)}
+}
+
+func (h *temporalKeysHandler) WithGroup(name string) slog.Handler {
+	return &temporalKeysHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+func renameTemporalKey(a slog.Attr) slog.Attr {
+	if k, ok := temporalKeys[a.Key]; ok {
+		a.Key = k
+	}
+	return a
+}
+
 // NewZerologHandler converts an instance of Zerolog into a Temporal log handler
 func NewZerologHandler(zlog *zerolog.Logger) log.Logger {
-	return log.NewStructuredLogger(slog.New(slogzerolog.Option{
+	return NewSlogHandler(slog.New(slogzerolog.Option{
 		Logger: zlog,
 	}.NewZerologHandler()))
 }
+
+// NewSlogHandler converts an instance of slog into a Temporal log handler. If
+// nil, the shared logger from the logger package is used.
+func NewSlogHandler(l *slog.Logger) log.Logger {
+	if l == nil {
+		l = logger.Default()
+	}
+	return log.NewStructuredLogger(slog.New(&temporalKeysHandler{Handler: l.Handler()}))
+}
@@ -0,0 +1,224 @@
+/*
+ * Copyright 2023 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package temporal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/mrsimonemms/golang-helpers/logger"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	otelprom "go.opentelemetry.io/otel/exporters/prometheus"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.temporal.io/sdk/client"
+	sdkotel "go.temporal.io/sdk/contrib/opentelemetry"
+)
+
+type OpenTelemetryMetricsOption func(*otelMetricsConfig)
+
+type otelMetricsConfig struct {
+	meterProvider metric.MeterProvider
+	otlp          bool
+	otlpOpts      []otlpmetricgrpc.Option
+	prometheus    bool
+	promAddress   string
+	promRegistry  *prom.Registry
+	promOpts      []PrometheusOption
+}
+
+// otelCloser flushes the meter provider and stops the Prometheus listener,
+// if there is one
+type otelCloser struct {
+	provider *sdkmetric.MeterProvider
+	promSrv  io.Closer
+}
+
+func (c *otelCloser) Close() error {
+	var err error
+	if c.provider != nil {
+		if shutdownErr := c.provider.Shutdown(context.Background()); shutdownErr != nil {
+			err = fmt.Errorf("error shutting down meter provider: %w", shutdownErr)
+		}
+	}
+	if c.promSrv != nil {
+		err = errors.Join(err, c.promSrv.Close())
+	}
+	return err
+}
+
+// WithOpenTelemetryMeterProvider uses an existing meter provider, rather than
+// creating one. Any exporters are ignored.
+func WithOpenTelemetryMeterProvider(mp metric.MeterProvider) OpenTelemetryMetricsOption {
+	return func(c *otelMetricsConfig) {
+		c.meterProvider = mp
+	}
+}
+
+// WithOpenTelemetryOTLP exports the metrics over OTLP gRPC. The exporter reads
+// the standard OTEL_EXPORTER_OTLP_* environment variables. This is the default
+// if there are no other exporters.
+func WithOpenTelemetryOTLP(opts ...otlpmetricgrpc.Option) OpenTelemetryMetricsOption {
+	return func(c *otelMetricsConfig) {
+		c.otlp = true
+		c.otlpOpts = opts
+	}
+}
+
+// WithOpenTelemetryPrometheus exposes the metrics for Prometheus to scrape on
+// /metrics at the listen address. It takes the same options as
+// NewPrometheusHandler.
+func WithOpenTelemetryPrometheus(listenAddress string, registry *prom.Registry, opts ...PrometheusOption) OpenTelemetryMetricsOption {
+	return func(c *otelMetricsConfig) {
+		c.prometheus = true
+		c.promAddress = listenAddress
+		c.promRegistry = registry
+		c.promOpts = opts
+	}
+}
+
+// NewOpenTelemetryMetricsHandler creates a metrics handler that records on an
+// OpenTelemetry meter provider. Metric names are prefixed in the same way as
+// NewPrometheusHandler. Close the returned closer on shutdown to flush the
+// metrics.
+func NewOpenTelemetryMetricsHandler(
+	ctx context.Context,
+	prefix string,
+	opts ...OpenTelemetryMetricsOption,
+) (client.MetricsHandler, io.Closer, error) {
+	cfg := &otelMetricsConfig{}
+	for _, o := range opts {
+		o(cfg)
+	}
+
+	closer := &otelCloser{}
+
+	mp := cfg.meterProvider
+	if mp == nil {
+		provider, err := newMeterProvider(ctx, cfg, closer)
+		if err != nil {
+			return nil, nil, err
+		}
+		mp = provider
+	}
+
+	handler := sdkotel.NewMetricsHandler(sdkotel.MetricsHandlerOptions{
+		Meter: mp.Meter("temporal-sdk-go"),
+		OnError: func(err error) {
+			logger.Default().Error("Error in OpenTelemetry metrics", "error", err)
+		},
+	})
+
+	return withMetricsPrefix(handler, prefix), closer, nil
+}
+
+func newMeterProvider(ctx context.Context, cfg *otelMetricsConfig, closer *otelCloser) (*sdkmetric.MeterProvider, error) {
+	var providerOpts []sdkmetric.Option
+
+	if cfg.otlp || !cfg.prometheus {
+		exporter, err := otlpmetricgrpc.New(ctx, cfg.otlpOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("error creating otlp exporter: %w", err)
+		}
+		providerOpts = append(providerOpts, sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter)))
+	}
+
+	if cfg.prometheus {
+		reader, srv, err := newOTelPrometheusReader(cfg)
+		if err != nil {
+			return nil, err
+		}
+		providerOpts = append(providerOpts, sdkmetric.WithReader(reader))
+		closer.promSrv = srv
+	}
+
+	closer.provider = sdkmetric.NewMeterProvider(providerOpts...)
+	return closer.provider, nil
+}
+
+func newOTelPrometheusReader(cfg *otelMetricsConfig) (sdkmetric.Reader, io.Closer, error) {
+	promCfg := &prometheusConfig{
+		onError: func(err error) {
+			logger.Default().Error("Error in OpenTelemetry Prometheus exporter", "error", err)
+		},
+	}
+	for _, o := range cfg.promOpts {
+		o(promCfg)
+	}
+
+	var registerer prom.Registerer = prom.DefaultRegisterer
+	var gatherer prom.Gatherer = prom.DefaultGatherer
+	if cfg.promRegistry != nil {
+		registerer = cfg.promRegistry
+		gatherer = cfg.promRegistry
+	}
+
+	reader, err := otelprom.New(otelprom.WithRegisterer(registerer))
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating prometheus exporter: %w", err)
+	}
+
+	handler := promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{})
+	if promCfg.mount != nil {
+		promCfg.mount(handler)
+		return reader, nil, nil
+	}
+
+	srv, err := servePrometheus(cfg.promAddress, handler, promCfg.onError)
+	if err != nil {
+		return nil, nil, err
+	}
+	return reader, &prometheusCloser{srv: srv}, nil
+}
+
+// prefixMetricsHandler adds the prefix to every metric name, separated in the
+// same way as the tally Prometheus reporter
+type prefixMetricsHandler struct {
+	client.MetricsHandler
+	prefix string
+}
+
+func withMetricsPrefix(h client.MetricsHandler, prefix string) client.MetricsHandler {
+	if prefix == "" {
+		return h
+	}
+	return &prefixMetricsHandler{MetricsHandler: h, prefix: prefix}
+}
+
+func (h *prefixMetricsHandler) name(name string) string {
+	return h.prefix + "_" + name
+}
+
+func (h *prefixMetricsHandler) WithTags(tags map[string]string) client.MetricsHandler {
+	return &prefixMetricsHandler{MetricsHandler: h.MetricsHandler.WithTags(tags), prefix: h.prefix}
+}
+
+func (h *prefixMetricsHandler) Counter(name string) client.MetricsCounter {
+	return h.MetricsHandler.Counter(h.name(name))
+}
+
+func (h *prefixMetricsHandler) Gauge(name string) client.MetricsGauge {
+	return h.MetricsHandler.Gauge(h.name(name))
+}
+
+func (h *prefixMetricsHandler) Timer(name string) client.MetricsTimer {
+	return h.MetricsHandler.Timer(h.name(name))
+}
@@ -0,0 +1,165 @@
+/*
+ * Copyright 2023 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package temporal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	commonpb "go.temporal.io/api/common/v1"
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/converter"
+	"go.temporal.io/sdk/interceptor"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/worker"
+	"go.temporal.io/sdk/workflow"
+)
+
+func TestNewOpenTelemetryMetricsHandler(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+
+	metrics, closer, err := NewOpenTelemetryMetricsHandler(context.Background(), "test",
+		WithOpenTelemetryMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))),
+	)
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, closer.Close())
+	}()
+
+	metrics.WithTags(map[string]string{"key": "value"}).Counter("requests").Inc(1)
+
+	var data metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &data))
+	require.Len(t, data.ScopeMetrics, 1)
+	require.Len(t, data.ScopeMetrics[0].Metrics, 1)
+	assert.Equal(t, "test_requests", data.ScopeMetrics[0].Metrics[0].Name)
+}
+
+func TestNewOpenTelemetryMetricsHandlerPrometheus(t *testing.T) {
+	var scrape http.Handler
+
+	metrics, closer, err := NewOpenTelemetryMetricsHandler(context.Background(), "test",
+		WithOpenTelemetryPrometheus("", prom.NewRegistry(), WithPrometheusHTTPHandler(func(h http.Handler) {
+			scrape = h
+		})),
+	)
+	require.NoError(t, err)
+	require.NotNil(t, scrape)
+
+	metrics.Counter("requests").Inc(1)
+
+	rec := httptest.NewRecorder()
+	scrape.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", http.NoBody))
+	assert.Contains(t, rec.Body.String(), "test_requests")
+
+	assert.NoError(t, closer.Close())
+}
+
+func TestWithOpenTelemetryMetrics(t *testing.T) {
+	opt, closer, err := WithOpenTelemetryMetrics(context.Background(), "test",
+		WithOpenTelemetryPrometheus("", prom.NewRegistry(), WithPrometheusHTTPHandler(func(http.Handler) {})),
+	)
+	require.NoError(t, err)
+
+	o, err := applyOptions(opt)
+	require.NoError(t, err)
+	require.NotNil(t, o.MetricsHandler)
+	assert.NoError(t, closer.Close())
+
+	// The meter provider it created has been shut down
+	assert.Error(t, closer.Close())
+}
+
+func TestWithOpenTelemetryTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	o, err := applyOptions(WithOpenTelemetryTracing(tp))
+	require.NoError(t, err)
+	require.Len(t, o.Interceptors, 1)
+
+	tracing, ok := o.Interceptors[0].(interceptor.WorkerInterceptor)
+	require.True(t, ok)
+
+	// The span the workflow is started in, as the client would send it
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "start")
+	carrier := map[string]string{}
+	propagation.TraceContext{}.Inject(ctx, propagation.MapCarrier(carrier))
+	parent.End()
+
+	payload, err := converter.GetDefaultDataConverter().ToPayload(carrier)
+	require.NoError(t, err)
+
+	act := func(context.Context) error { return nil }
+	wf := func(ctx workflow.Context) error {
+		ctx = workflow.WithActivityOptions(ctx, workflow.ActivityOptions{StartToCloseTimeout: time.Minute})
+		return workflow.ExecuteActivity(ctx, act).Get(ctx, nil)
+	}
+
+	var s testsuite.WorkflowTestSuite
+	env := s.NewTestWorkflowEnvironment()
+	env.SetWorkerOptions(worker.Options{Interceptors: []interceptor.WorkerInterceptor{tracing}})
+	env.SetHeader(&commonpb.Header{Fields: map[string]*commonpb.Payload{"_tracer-data": payload}})
+	env.RegisterWorkflowWithOptions(wf, workflow.RegisterOptions{Name: "TracedWorkflow"})
+	env.RegisterActivityWithOptions(act, activity.RegisterOptions{Name: "TracedActivity"})
+
+	env.ExecuteWorkflow("TracedWorkflow")
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+
+	parentID := parent.SpanContext()
+	for _, name := range []string{"RunWorkflow:TracedWorkflow", "RunActivity:TracedActivity"} {
+		span, ok := spans[name]
+		require.True(t, ok, "missing span %s", name)
+		assert.Equal(t, parentID.TraceID(), span.SpanContext().TraceID(), name)
+		assert.True(t, descendsFrom(spans, span, parentID.SpanID()), "%s isn't a child of the starting span", name)
+	}
+}
+
+// descendsFrom walks up the span's parents to find the ancestor
+func descendsFrom(spans map[string]sdktrace.ReadOnlySpan, span sdktrace.ReadOnlySpan, ancestor trace.SpanID) bool {
+	byID := map[trace.SpanID]sdktrace.ReadOnlySpan{}
+	for _, s := range spans {
+		byID[s.SpanContext().SpanID()] = s
+	}
+
+	for span != nil {
+		parent := span.Parent().SpanID()
+		if parent == ancestor {
+			return true
+		}
+		span = byID[parent]
+	}
+	return false
+}
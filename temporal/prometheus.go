@@ -17,33 +17,108 @@
 package temporal
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
 	"time"
 
+	"github.com/mrsimonemms/golang-helpers/logger"
 	prom "github.com/prometheus/client_golang/prometheus"
-	"github.com/rs/zerolog/log"
 	"github.com/uber-go/tally/v4"
 	"github.com/uber-go/tally/v4/prometheus"
 	"go.temporal.io/sdk/client"
 	sdktally "go.temporal.io/sdk/contrib/tally"
 )
 
-func NewPrometheusHandler(listenAddress, prefix string, registry *prom.Registry) (client.MetricsHandler, error) {
-	c := prometheus.Configuration{
-		ListenAddress: listenAddress,
-		TimerType:     "histogram",
+type PrometheusOption func(*prometheusConfig)
+
+type prometheusConfig struct {
+	onError func(error)
+	mount   func(http.Handler)
+}
+
+// prometheusCloser flushes the metrics and stops the listener, if there is one
+type prometheusCloser struct {
+	scope io.Closer
+	srv   *http.Server
+}
+
+func (c *prometheusCloser) Close() error {
+	var err error
+	if c.scope != nil {
+		err = c.scope.Close()
+	}
+
+	if c.srv != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if srvErr := c.srv.Shutdown(ctx); srvErr != nil {
+			err = errors.Join(err, fmt.Errorf("error shutting down prometheus server: %w", srvErr))
+		}
+	}
+
+	return err
+}
+
+// WithPrometheusErrorHandler is called with errors from the reporter and the
+// listener. Defaults to logging them.
+func WithPrometheusErrorHandler(fn func(error)) PrometheusOption {
+	return func(c *prometheusConfig) {
+		c.onError = fn
 	}
+}
 
-	reporter, err := c.NewReporter(
-		prometheus.ConfigurationOptions{
-			Registry: registry,
-			OnError: func(err error) {
-				log.Fatal().Err(err).Msg("Error in Prometheus reporter")
-			},
+// WithPrometheusHTTPHandler passes the scrape handler to the function, so it
+// can be mounted on an existing server. No listener is started.
+func WithPrometheusHTTPHandler(mount func(http.Handler)) PrometheusOption {
+	return func(c *prometheusConfig) {
+		c.mount = mount
+	}
+}
+
+// NewPrometheusHandler creates a metrics handler that reports to Prometheus,
+// served on /metrics at the listen address. Use WithPrometheusHTTPHandler to
+// mount it on an existing server instead. Close the returned closer on
+// shutdown to flush the metrics and stop the listener.
+func NewPrometheusHandler(
+	listenAddress, prefix string,
+	registry *prom.Registry,
+	opts ...PrometheusOption,
+) (client.MetricsHandler, io.Closer, error) {
+	cfg := &prometheusConfig{
+		onError: func(err error) {
+			logger.Default().Error("Error in Prometheus reporter", "error", err)
 		},
-	)
-	if err != nil {
-		return nil, fmt.Errorf("error creating reporter: %w", err)
+	}
+	for _, o := range opts {
+		o(cfg)
+	}
+
+	reporterOpts := prometheus.Options{
+		DefaultTimerType: prometheus.HistogramTimerType,
+		OnRegisterError:  cfg.onError,
+	}
+	if registry != nil {
+		// Avoid a typed nil, which would stop the defaults being used
+		reporterOpts.Registerer = registry
+		reporterOpts.Gatherer = registry
+	}
+	reporter := prometheus.NewReporter(reporterOpts)
+
+	closer := &prometheusCloser{}
+
+	if cfg.mount != nil {
+		cfg.mount(reporter.HTTPHandler())
+	} else {
+		srv, err := servePrometheus(listenAddress, reporter.HTTPHandler(), cfg.onError)
+		if err != nil {
+			return nil, nil, err
+		}
+		closer.srv = srv
 	}
 
 	scopeOpts := tally.ScopeOptions{
@@ -52,9 +127,37 @@ func NewPrometheusHandler(listenAddress, prefix string, registry *prom.Registry)
 		SanitizeOptions: &sdktally.PrometheusSanitizeOptions,
 		Prefix:          prefix,
 	}
-	scope, _ := tally.NewRootScope(scopeOpts, time.Second)
-	scope = sdktally.NewPrometheusNamingScope(scope)
+	scope, scopeCloser := tally.NewRootScope(scopeOpts, time.Second)
+	closer.scope = scopeCloser
+
+	return sdktally.NewMetricsHandler(sdktally.NewPrometheusNamingScope(scope)), closer, nil
+}
+
+func servePrometheus(listenAddress string, handler http.Handler, onError func(error)) (*http.Server, error) {
+	if listenAddress == "" {
+		return nil, errors.New("prometheus listen address required, or use WithPrometheusHTTPHandler")
+	}
+
+	lis, err := net.Listen("tcp", listenAddress) //nolint:noctx // The listener outlives any context here
+	if err != nil {
+		return nil, fmt.Errorf("error listening for prometheus: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", handler)
+
+	srv := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: time.Second,
+	}
+
+	logger.Default().Info("Starting Prometheus service", "address", lis.Addr().String())
+
+	go func() {
+		if err := srv.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			onError(fmt.Errorf("error serving prometheus: %w", err))
+		}
+	}()
 
-	log.Info().Str("address", listenAddress).Msg("Starting Prometheus service")
-	return sdktally.NewMetricsHandler(scope), nil
+	return srv, nil
 }
@@ -0,0 +1,82 @@
+/*
+ * Copyright 2023 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package temporal
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPrometheusHandlerMount(t *testing.T) {
+	var scrape http.Handler
+
+	metrics, closer, err := NewPrometheusHandler("", "test", prom.NewRegistry(), WithPrometheusHTTPHandler(func(h http.Handler) {
+		scrape = h
+	}))
+	require.NoError(t, err)
+	require.NotNil(t, scrape)
+
+	metrics.Counter("requests").Inc(1)
+
+	// Closing flushes the metrics to the reporter
+	require.NoError(t, closer.Close())
+
+	rec := httptest.NewRecorder()
+	scrape.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", http.NoBody))
+	assert.Contains(t, rec.Body.String(), "test_requests")
+}
+
+func TestNewPrometheusHandlerListen(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = lis.Close()
+	})
+
+	// The port is in use, so this should fail rather than exit
+	_, _, err = NewPrometheusHandler(lis.Addr().String(), "test", prom.NewRegistry())
+	assert.Error(t, err)
+
+	_, closer, err := NewPrometheusHandler("127.0.0.1:0", "test", prom.NewRegistry())
+	require.NoError(t, err)
+	assert.NoError(t, closer.Close())
+}
+
+func TestNewPrometheusHandlerNoAddress(t *testing.T) {
+	// Nothing is registered on the default mux, so it must be mounted
+	_, _, err := NewPrometheusHandler("", "test", prom.NewRegistry())
+	assert.Error(t, err)
+
+	_, pattern := http.DefaultServeMux.Handler(httptest.NewRequest(http.MethodGet, "/metrics", http.NoBody))
+	assert.Empty(t, pattern)
+}
+
+func TestWithPrometheusMetrics(t *testing.T) {
+	opt, closer, err := WithPrometheusMetrics("127.0.0.1:0", "test", prom.NewRegistry())
+	require.NoError(t, err)
+
+	o, err := applyOptions(opt)
+	require.NoError(t, err)
+	require.NotNil(t, o.MetricsHandler)
+	assert.NoError(t, closer.Close())
+}
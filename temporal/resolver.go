@@ -0,0 +1,198 @@
+/*
+ * Copyright 2023 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package temporal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mrsimonemms/golang-helpers/logger"
+	"google.golang.org/grpc/resolver"
+)
+
+const (
+	ResolverSRVPrefix  = "srv://"
+	ResolverFilePrefix = "file://"
+
+	// resolverScheme is the gRPC scheme used for the resolved endpoints
+	resolverScheme = "temporal-endpoints"
+
+	defaultResolveInterval = 30 * time.Second
+	defaultResolveTimeout  = 10 * time.Second
+)
+
+// HostPortResolver returns the host:port endpoints of the Temporal frontend
+type HostPortResolver func(ctx context.Context) ([]string, error)
+
+// NewSRVResolver looks up the endpoints from a DNS SRV record, such as
+// _temporal._tcp.example.com
+func NewSRVResolver(name string) HostPortResolver {
+	return func(ctx context.Context) ([]string, error) {
+		_, records, err := net.DefaultResolver.LookupSRV(ctx, "", "", name)
+		if err != nil {
+			return nil, fmt.Errorf("error looking up srv record: %w", err)
+		}
+
+		endpoints := make([]string, 0, len(records))
+		for _, r := range records {
+			endpoints = append(endpoints, net.JoinHostPort(strings.TrimSuffix(r.Target, "."), strconv.Itoa(int(r.Port))))
+		}
+		return endpoints, nil
+	}
+}
+
+// NewFileResolver reads the endpoints from a file, one per line. Blank lines
+// and lines starting with # are ignored.
+func NewFileResolver(path string) HostPortResolver {
+	return func(context.Context) ([]string, error) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading endpoints file: %w", err)
+		}
+
+		var endpoints []string
+		for line := range strings.Lines(string(data)) {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			endpoints = append(endpoints, line)
+		}
+		return endpoints, nil
+	}
+}
+
+// ParseHostPortResolver creates a resolver from a srv://name or file:///path
+// reference
+func ParseHostPortResolver(ref string) (HostPortResolver, error) {
+	switch {
+	case strings.HasPrefix(ref, ResolverSRVPrefix):
+		return NewSRVResolver(strings.TrimPrefix(ref, ResolverSRVPrefix)), nil
+	case strings.HasPrefix(ref, ResolverFilePrefix):
+		return NewFileResolver(strings.TrimPrefix(ref, ResolverFilePrefix)), nil
+	default:
+		return nil, fmt.Errorf("unknown host port resolver: %s", ref)
+	}
+}
+
+// hostPortBuilder is a gRPC resolver for the endpoints. They're resolved when
+// the connection is made and then periodically, so the connection follows
+// changes to the DNS record or file.
+type hostPortBuilder struct {
+	resolve  HostPortResolver
+	interval time.Duration
+	timeout  time.Duration
+}
+
+type hostPortResolver struct {
+	*hostPortBuilder
+	cc         resolver.ClientConn
+	ctx        context.Context
+	cancel     context.CancelFunc
+	resolveNow chan struct{}
+	done       chan struct{}
+}
+
+func newHostPortBuilder(r HostPortResolver) *hostPortBuilder {
+	return &hostPortBuilder{
+		resolve:  r,
+		interval: defaultResolveInterval,
+		timeout:  defaultResolveTimeout,
+	}
+}
+
+func (b *hostPortBuilder) Build(_ resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions) (resolver.Resolver, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	r := &hostPortResolver{
+		hostPortBuilder: b,
+		cc:              cc,
+		ctx:             ctx,
+		cancel:          cancel,
+		resolveNow:      make(chan struct{}, 1),
+		done:            make(chan struct{}),
+	}
+	go r.watch()
+
+	return r, nil
+}
+
+func (b *hostPortBuilder) Scheme() string {
+	return resolverScheme
+}
+
+// ResolveNow is called by gRPC when a connection fails
+func (r *hostPortResolver) ResolveNow(resolver.ResolveNowOptions) {
+	select {
+	case r.resolveNow <- struct{}{}:
+	default:
+	}
+}
+
+func (r *hostPortResolver) Close() {
+	r.cancel()
+	<-r.done
+}
+
+func (r *hostPortResolver) watch() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		r.update()
+
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.resolveNow:
+		}
+	}
+}
+
+func (r *hostPortResolver) update() {
+	ctx, cancel := context.WithTimeout(r.ctx, r.timeout)
+	defer cancel()
+
+	endpoints, err := r.resolve(ctx)
+	if err == nil && len(endpoints) == 0 {
+		err = errors.New("no temporal endpoints found")
+	}
+	if err != nil {
+		// The connection keeps the last endpoints, so this only fails requests
+		// if it's never resolved
+		r.cc.ReportError(fmt.Errorf("error resolving temporal endpoints: %w", err))
+		return
+	}
+
+	addresses := make([]resolver.Address, 0, len(endpoints))
+	for _, e := range endpoints {
+		addresses = append(addresses, resolver.Address{Addr: e})
+	}
+
+	if err := r.cc.UpdateState(resolver.State{Addresses: addresses}); err != nil {
+		logger.Default().Warn("Error updating temporal endpoints", "error", err)
+	}
+}
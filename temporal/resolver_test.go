@@ -0,0 +1,172 @@
+/*
+ * Copyright 2023 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package temporal
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/resolver"
+)
+
+func TestParseHostPortResolver(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "endpoints")
+	require.NoError(t, os.WriteFile(path, []byte(`
+# Frontends
+10.0.0.1:7233
+
+10.0.0.2:7233
+`), 0o600))
+
+	tests := []struct {
+		Name     string
+		Ref      string
+		Expected []string
+		Error    bool
+	}{
+		{
+			Name:     "file",
+			Ref:      ResolverFilePrefix + path,
+			Expected: []string{"10.0.0.1:7233", "10.0.0.2:7233"},
+		},
+		{
+			Name:  "missing file",
+			Ref:   ResolverFilePrefix + filepath.Join(t.TempDir(), "missing"),
+			Error: true,
+		},
+		{
+			Name:  "unknown",
+			Ref:   "temporal:7233",
+			Error: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			r, err := ParseHostPortResolver(test.Ref)
+			if err == nil {
+				var endpoints []string
+				endpoints, err = r(context.Background())
+				assert.Equal(t, test.Expected, endpoints)
+			}
+
+			if test.Error {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+// fakeClientConn records the state the resolver sends to gRPC
+type fakeClientConn struct {
+	resolver.ClientConn
+	mu     sync.Mutex
+	states []resolver.State
+	errs   []error
+}
+
+func (f *fakeClientConn) UpdateState(s resolver.State) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.states = append(f.states, s)
+	return nil
+}
+
+func (f *fakeClientConn) ReportError(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.errs = append(f.errs, err)
+}
+
+func (f *fakeClientConn) addresses() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.states) == 0 {
+		return nil
+	}
+	var out []string
+	for _, a := range f.states[len(f.states)-1].Addresses {
+		out = append(out, a.Addr)
+	}
+	return out
+}
+
+func (f *fakeClientConn) errors() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.errs)
+}
+
+func TestHostPortBuilder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "endpoints")
+	require.NoError(t, os.WriteFile(path, []byte("10.0.0.1:7233\n"), 0o600))
+
+	b := newHostPortBuilder(NewFileResolver(path))
+	b.interval = 10 * time.Millisecond
+	assert.Equal(t, resolverScheme, b.Scheme())
+
+	cc := &fakeClientConn{}
+	r, err := b.Build(resolver.Target{}, cc, resolver.BuildOptions{})
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		return slices.Equal(cc.addresses(), []string{"10.0.0.1:7233"})
+	}, time.Second, 5*time.Millisecond)
+
+	// Changes are picked up
+	require.NoError(t, os.WriteFile(path, []byte("10.0.0.2:7233\n10.0.0.3:7233\n"), 0o600))
+	assert.Eventually(t, func() bool {
+		return slices.Equal(cc.addresses(), []string{"10.0.0.2:7233", "10.0.0.3:7233"})
+	}, time.Second, 5*time.Millisecond)
+
+	// Failures are reported, and the last endpoints kept
+	require.NoError(t, os.WriteFile(path, nil, 0o600))
+	assert.Eventually(t, func() bool { return cc.errors() > 0 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []string{"10.0.0.2:7233", "10.0.0.3:7233"}, cc.addresses())
+
+	r.Close()
+}
+
+func TestHostPortBuilderTimeout(t *testing.T) {
+	b := newHostPortBuilder(func(ctx context.Context) ([]string, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	b.timeout = 10 * time.Millisecond
+
+	cc := &fakeClientConn{}
+	r, err := b.Build(resolver.Target{}, cc, resolver.BuildOptions{})
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool { return cc.errors() > 0 }, time.Second, 5*time.Millisecond)
+
+	// ResolveNow tries again straight away
+	r.ResolveNow(resolver.ResolveNowOptions{})
+	assert.Eventually(t, func() bool { return cc.errors() > 1 }, time.Second, 5*time.Millisecond)
+
+	r.Close()
+}
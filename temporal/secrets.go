@@ -0,0 +1,127 @@
+/*
+ * Copyright 2023 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package temporal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mrsimonemms/golang-helpers/logger"
+	"go.temporal.io/sdk/client"
+)
+
+const (
+	// SecretEnvPrefix references an environment variable, such as env://API_KEY
+	SecretEnvPrefix = "env://"
+	// SecretFilePrefix references a file, such as file:///secrets/api-key
+	SecretFilePrefix = "file://"
+)
+
+// ResolveSecret returns the value of an env:// or file:// reference. Anything
+// else is returned as it is. The value is registered with the logger so it's
+// never logged.
+func ResolveSecret(ref string) (string, error) {
+	var value string
+
+	switch {
+	case strings.HasPrefix(ref, SecretEnvPrefix):
+		name := strings.TrimPrefix(ref, SecretEnvPrefix)
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("secret environment variable not set: %s", name)
+		}
+		value = v
+	case strings.HasPrefix(ref, SecretFilePrefix):
+		data, err := os.ReadFile(strings.TrimPrefix(ref, SecretFilePrefix))
+		if err != nil {
+			return "", fmt.Errorf("error reading secret file: %w", err)
+		}
+		value = strings.TrimSpace(string(data))
+	default:
+		value = ref
+	}
+
+	logger.AddSecret(value)
+	return value, nil
+}
+
+// WithAPIKeyFile authenticates with the API key in the file. The file is
+// checked on each request and re-read if it's changed, so a rotated key is
+// used without restarting.
+func WithAPIKeyFile(path string) Options {
+	return func(o *client.Options) error {
+		f := &apiKeyFile{path: path}
+		// Fail now, rather than on the first request
+		if _, err := f.read(); err != nil {
+			return err
+		}
+
+		return WithCredentials(client.NewAPIKeyDynamicCredentials(f.get))(o)
+	}
+}
+
+type apiKeyFile struct {
+	path string
+
+	mu  sync.Mutex
+	key string
+	mod time.Time
+}
+
+func (f *apiKeyFile) read() (string, error) {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return "", fmt.Errorf("error reading api key file: %w", err)
+	}
+
+	if f.key != "" && info.ModTime().Equal(f.mod) {
+		return f.key, nil
+	}
+
+	key, err := ResolveSecret(SecretFilePrefix + f.path)
+	if err != nil {
+		return "", err
+	}
+	if key == "" {
+		return "", errors.New("api key file is empty")
+	}
+
+	if f.key != "" {
+		logger.Default().Info("Reloaded Temporal API key", "path", f.path)
+	}
+	f.key = key
+	f.mod = info.ModTime()
+	return key, nil
+}
+
+func (f *apiKeyFile) get(context.Context) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key, err := f.read()
+	if err != nil {
+		// Keep using the old key, which may still be valid
+		logger.Default().Error("Error reloading Temporal API key", "error", err)
+		return f.key, nil
+	}
+	return key, nil
+}
@@ -0,0 +1,111 @@
+/*
+ * Copyright 2023 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package temporal
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveSecret(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret")
+	require.NoError(t, os.WriteFile(path, []byte("file-secret\n"), 0o600))
+	t.Setenv("TEST_SECRET", "env-secret")
+
+	tests := []struct {
+		Name     string
+		Ref      string
+		Expected string
+		Error    bool
+	}{
+		{
+			Name:     "literal",
+			Ref:      "literal-secret",
+			Expected: "literal-secret",
+		},
+		{
+			Name:     "env",
+			Ref:      "env://TEST_SECRET",
+			Expected: "env-secret",
+		},
+		{
+			Name:  "missing env",
+			Ref:   "env://TEST_SECRET_UNSET",
+			Error: true,
+		},
+		{
+			Name:     "file",
+			Ref:      "file://" + path,
+			Expected: "file-secret",
+		},
+		{
+			Name:  "missing file",
+			Ref:   "file://" + path + "-missing",
+			Error: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			value, err := ResolveSecret(test.Ref)
+			if test.Error {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.Expected, value)
+		})
+	}
+}
+
+func TestAPIKeyFileReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api-key")
+
+	_, err := applyOptions(WithAPICredentials("file://" + path))
+	assert.Error(t, err)
+
+	require.NoError(t, os.WriteFile(path, []byte("first-key"), 0o600))
+	o, err := applyOptions(WithAPICredentials("file://" + path))
+	require.NoError(t, err)
+	assert.NotNil(t, o.Credentials)
+
+	f := &apiKeyFile{path: path}
+	key, err := f.get(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "first-key", key)
+
+	// Rotate the key, making sure the modification time changes
+	require.NoError(t, os.WriteFile(path, []byte("second-key"), 0o600))
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(path, future, future))
+
+	key, err = f.get(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "second-key", key)
+
+	// Keeps the last key if the file disappears
+	require.NoError(t, os.Remove(path))
+	key, err = f.get(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "second-key", key)
+}
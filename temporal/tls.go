@@ -0,0 +1,182 @@
+/*
+ * Copyright 2023 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package temporal
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mrsimonemms/golang-helpers/logger"
+)
+
+// WithTLSCAFile trusts the CA certificates in the PEM file, such as a private
+// CA for a self-hosted cluster. The system CAs aren't trusted once a CA is
+// added.
+func WithTLSCAFile(path string) TLSOptions {
+	return func(c *tls.Config) error {
+		if path == "" {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("error reading ca file: %w", err)
+		}
+
+		return WithTLSCAPEM(data)(c)
+	}
+}
+
+// WithTLSCAPEM trusts the PEM encoded CA certificates. The system CAs aren't
+// trusted once a CA is added.
+func WithTLSCAPEM(data []byte) TLSOptions {
+	return func(c *tls.Config) error {
+		if c.RootCAs == nil {
+			c.RootCAs = x509.NewCertPool()
+		}
+
+		if !c.RootCAs.AppendCertsFromPEM(data) {
+			return errors.New("no ca certificates found in pem")
+		}
+		return nil
+	}
+}
+
+// WithTLSMinVersion sets the minimum TLS version, such as tls.VersionTLS13
+func WithTLSMinVersion(version uint16) TLSOptions {
+	return func(c *tls.Config) error {
+		c.MinVersion = version
+		return nil
+	}
+}
+
+// WithTLSClientCertPEM presents the PEM encoded client certificate for mTLS
+func WithTLSClientCertPEM(certPEM, keyPEM []byte) TLSOptions {
+	return func(c *tls.Config) error {
+		if c.GetClientCertificate != nil || len(c.Certificates) > 0 {
+			return errors.New("client certificate already set")
+		}
+
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return fmt.Errorf("error parsing client certificate: %w", err)
+		}
+
+		c.Certificates = []tls.Certificate{cert}
+		return nil
+	}
+}
+
+// WithTLSInsecureSkipVerify skips verifying the server's certificate. Only
+// use this for testing.
+func WithTLSInsecureSkipVerify(skip bool) TLSOptions {
+	return func(c *tls.Config) error {
+		c.InsecureSkipVerify = skip //nolint:gosec // Explicitly requested
+		return nil
+	}
+}
+
+// WithTLSClientCertFiles presents the client certificate for mTLS. The files
+// are checked on each new connection and reloaded if they've changed, so
+// rotated certificates are used without restarting.
+func WithTLSClientCertFiles(certPath, keyPath string) TLSOptions {
+	return func(c *tls.Config) error {
+		if certPath == "" && keyPath == "" {
+			return nil
+		}
+		if c.GetClientCertificate != nil || len(c.Certificates) > 0 {
+			return errors.New("client certificate already set")
+		}
+
+		r := &certReloader{
+			certPath: certPath,
+			keyPath:  keyPath,
+		}
+		// Fail now, rather than on the first connection
+		if err := r.reload(); err != nil {
+			return err
+		}
+
+		c.GetClientCertificate = r.getClientCertificate
+		return nil
+	}
+}
+
+type certReloader struct {
+	certPath string
+	keyPath  string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	certMod time.Time
+	keyMod  time.Time
+}
+
+func (r *certReloader) modTimes() (certMod, keyMod time.Time, err error) {
+	certInfo, err := os.Stat(r.certPath)
+	if err != nil {
+		return certMod, keyMod, fmt.Errorf("error reading client cert: %w", err)
+	}
+	keyInfo, err := os.Stat(r.keyPath)
+	if err != nil {
+		return certMod, keyMod, fmt.Errorf("error reading client key: %w", err)
+	}
+	return certInfo.ModTime(), keyInfo.ModTime(), nil
+}
+
+func (r *certReloader) reload() error {
+	certMod, keyMod, err := r.modTimes()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certPath, r.keyPath)
+	if err != nil {
+		return fmt.Errorf("error loading tls key pair: %w", err)
+	}
+
+	r.cert = &cert
+	r.certMod = certMod
+	r.keyMod = keyMod
+	return nil
+}
+
+func (r *certReloader) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	certMod, keyMod, err := r.modTimes()
+	if err == nil && (!certMod.Equal(r.certMod) || !keyMod.Equal(r.keyMod)) {
+		err = r.reload()
+		if err == nil {
+			logger.Default().Info("Reloaded Temporal client certificate", "certPath", r.certPath)
+		}
+	}
+
+	if err != nil {
+		// Keep using the old certificate, which may still be valid. A rotation
+		// can be caught between writing the cert and the key.
+		logger.Default().Error("Error reloading Temporal client certificate", "error", err)
+	}
+
+	return r.cert, nil
+}
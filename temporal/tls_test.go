@@ -0,0 +1,114 @@
+/*
+ * Copyright 2023 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package temporal
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestCert writes a self-signed certificate and key, returning the
+// certificate PEM
+func writeTestCert(t *testing.T, certPath, keyPath, name string) []byte {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	require.NoError(t, os.WriteFile(certPath, certPEM, 0o600))
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+
+	return certPEM
+}
+
+func TestTLSCA(t *testing.T) {
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "ca.pem")
+	writeTestCert(t, certPath, filepath.Join(dir, "ca.key"), "ca")
+
+	c := &tls.Config{}
+	require.NoError(t, WithTLSCAFile(certPath)(c))
+	require.NoError(t, WithTLSMinVersion(tls.VersionTLS13)(c))
+	assert.NotNil(t, c.RootCAs)
+	assert.Equal(t, uint16(tls.VersionTLS13), c.MinVersion)
+
+	assert.Error(t, WithTLSCAFile(filepath.Join(dir, "missing.pem"))(c))
+	assert.Error(t, WithTLSCAPEM([]byte("not a cert"))(c))
+}
+
+func TestTLSClientCertFilesReload(t *testing.T) {
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "client.pem")
+	keyPath := filepath.Join(dir, "client.key")
+
+	assert.Error(t, WithTLSClientCertFiles(certPath, keyPath)(&tls.Config{}))
+
+	writeTestCert(t, certPath, keyPath, "first")
+
+	c := &tls.Config{}
+	require.NoError(t, WithTLSClientCertFiles(certPath, keyPath)(c))
+
+	first, err := c.GetClientCertificate(nil)
+	require.NoError(t, err)
+
+	// Rotate the certificate, making sure the modification time changes
+	writeTestCert(t, certPath, keyPath, "second")
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certPath, future, future))
+	require.NoError(t, os.Chtimes(keyPath, future, future))
+
+	second, err := c.GetClientCertificate(nil)
+	require.NoError(t, err)
+	assert.NotEqual(t, first.Certificate[0], second.Certificate[0])
+
+	// A broken rotation keeps the last good certificate
+	require.NoError(t, os.WriteFile(keyPath, []byte("broken"), 0o600))
+	future = future.Add(time.Minute)
+	require.NoError(t, os.Chtimes(keyPath, future, future))
+
+	third, err := c.GetClientCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, second.Certificate[0], third.Certificate[0])
+}